@@ -0,0 +1,136 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// readAccessList reads an EIP-2930 access list given inline or as the
+// path of a file holding it, in the JSON that nodes use:
+//
+//   [{"address": "0x...", "storageKeys": ["0x...", ...]}, ...]
+//
+// Errors name the entry and field at fault, or the line and column of a
+// JSON syntax error.
+func readAccessList(arg string) (accessList, error) {
+	contents := []byte(arg)
+	if !strings.HasPrefix(strings.TrimSpace(arg), "[") {
+		var err error
+		if contents, err = ioutil.ReadFile(arg); err != nil {
+			return nil, err
+		}
+	}
+	return parseAccessList(contents)
+}
+
+func parseAccessList(contents []byte) (accessList, error) {
+	var entries []json.RawMessage
+	if err := json.Unmarshal(contents, &entries); err != nil {
+		switch err := err.(type) {
+		case *json.SyntaxError:
+			line, column := jsonPosition(contents, err.Offset)
+			return nil, fmt.Errorf("invalid JSON at line %d, column %d: %v", line, column, err)
+		case *json.UnmarshalTypeError:
+			return nil, fmt.Errorf("expected an array of {\"address\", \"storageKeys\"} entries, got a JSON %s", err.Value)
+		}
+		return nil, err
+	}
+
+	list := make(accessList, len(entries))
+	for i, entry := range entries {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(entry, &fields); err != nil || fields == nil {
+			return nil, fmt.Errorf("entry %d: expected an object with address and storageKeys", i)
+		}
+		for name := range fields {
+			if name != "address" && name != "storageKeys" {
+				return nil, fmt.Errorf("entry %d: unknown field %q", i, name)
+			}
+		}
+
+		address, err := accessListBytes(fields["address"], common.AddressLength)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: address %v", i, err)
+		}
+		list[i].Address = common.BytesToAddress(address)
+
+		raw, ok := fields["storageKeys"]
+		if !ok {
+			return nil, fmt.Errorf("entry %d: missing storageKeys (use [] for none)", i)
+		}
+		var keys []json.RawMessage
+		if err := json.Unmarshal(raw, &keys); err != nil || keys == nil {
+			return nil, fmt.Errorf("entry %d: storageKeys is not an array", i)
+		}
+		list[i].StorageKeys = make([]common.Hash, len(keys))
+		for j, key := range keys {
+			b, err := accessListBytes(key, common.HashLength)
+			if err != nil {
+				return nil, fmt.Errorf("entry %d: storageKeys[%d] %v", i, j, err)
+			}
+			list[i].StorageKeys[j] = common.BytesToHash(b)
+		}
+	}
+	return list, nil
+}
+
+// accessListBytes decodes a JSON hex string of exactly size bytes. Its
+// errors complete a sentence that starts with the field's name.
+func accessListBytes(raw json.RawMessage, size int) ([]byte, error) {
+	if raw == nil {
+		return nil, fmt.Errorf("is missing")
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, fmt.Errorf("is not a string")
+	}
+	b, err := hexutil.Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("is not 0x-prefixed hex: %v", err)
+	}
+	if len(b) != size {
+		return nil, fmt.Errorf("is not %d bytes", size)
+	}
+	return b, nil
+}
+
+// jsonPosition gives the 1-based line and column of the byte at which
+// a JSON syntax error was found, from its offset, which counts that byte.
+func jsonPosition(contents []byte, offset int64) (int, int) {
+	line, column := 1, 1
+	if offset > int64(len(contents)) {
+		offset = int64(len(contents))
+	}
+	for _, b := range contents[:offset-1] {
+		if b == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
+
+// accessListGas is the intrinsic gas an access list adds to a
+// transaction: 2400 per address and 1900 per storage key (EIP-2930).
+func accessListGas(list accessList) uint64 {
+	var gas uint64
+	for _, tuple := range list {
+		gas += 2400 + 1900*uint64(len(tuple.StorageKeys))
+	}
+	return gas
+}
+
+// storageKeyCount is the number of storage keys in an access list.
+func (list accessList) storageKeyCount() int {
+	var count int
+	for _, tuple := range list {
+		count += len(tuple.StorageKeys)
+	}
+	return count
+}
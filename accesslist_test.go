@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadAccessList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethsign-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const list = `[
+		{"address": "0x00000000000000000000000000000000000000aa", "storageKeys": [
+			"0x0000000000000000000000000000000000000000000000000000000000000001",
+			"0x0000000000000000000000000000000000000000000000000000000000000002"]},
+		{"address": "0x00000000000000000000000000000000000000bb", "storageKeys": []}
+	]`
+	want := accessList{
+		{common.HexToAddress("0xaa"), []common.Hash{common.HexToHash("0x01"), common.HexToHash("0x02")}},
+		{common.HexToAddress("0xbb"), []common.Hash{}},
+	}
+	path := filepath.Join(dir, "access-list.json")
+	if err := ioutil.WriteFile(path, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, arg := range []string{list, path} {
+		got, err := readAccessList(arg)
+		if err != nil {
+			t.Errorf("%.20q: %v", arg, err)
+		} else if !reflect.DeepEqual(got, want) {
+			t.Errorf("%.20q: got %v, want %v", arg, got, want)
+		}
+	}
+	if _, err := readAccessList(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("missing file: expected an error")
+	}
+
+	if gas := accessListGas(want); gas != 2*2400+2*1900 {
+		t.Errorf("got access list gas %d, want %d", gas, 2*2400+2*1900)
+	}
+}
+
+func TestCreateAccessList(t *testing.T) {
+	node, err := dialNode(fakeNode(t, map[string]interface{}{
+		"eth_createAccessList": map[string]interface{}{
+			"accessList": []interface{}{map[string]interface{}{
+				"address":     "0x00000000000000000000000000000000000000aa",
+				"storageKeys": []string{"0x0000000000000000000000000000000000000000000000000000000000000001"},
+			}},
+			"gasUsed": "0x7148",
+		},
+	}), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.close()
+
+	to := common.HexToAddress("0xaa")
+	list, gas, err := node.createAccessList(ethereum.CallMsg{To: &to})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := accessList{{common.HexToAddress("0xaa"), []common.Hash{common.HexToHash("0x01")}}}
+	if !reflect.DeepEqual(list, want) || gas != 29000 {
+		t.Errorf("got %v using %d gas, want %v using 29000", list, gas, want)
+	}
+
+	failing, err := dialNode(fakeNode(t, map[string]interface{}{
+		"eth_createAccessList": map[string]interface{}{"accessList": []interface{}{}, "gasUsed": "0x5208", "error": "execution reverted"},
+	}), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer failing.close()
+	if _, _, err := failing.createAccessList(ethereum.CallMsg{To: &to}); err == nil {
+		t.Error("reverting call: expected an error")
+	}
+}
+
+func TestParseAccessListErrors(t *testing.T) {
+	const (
+		address = `"0x00000000000000000000000000000000000000aa"`
+		key     = `"0x0000000000000000000000000000000000000000000000000000000000000001"`
+	)
+	tests := []struct {
+		list string
+		err  string
+	}{
+		{`[{"address": ` + address + `, "storageKeys": []}, {"address": ` + address + `, "storageKeys": [` + key + `, "0x01"]}]`,
+			"entry 1: storageKeys[1] is not 32 bytes"},
+		{`[{"address": "0xaa", "storageKeys": []}]`, "entry 0: address is not 20 bytes"},
+		{`[{"address": "aa", "storageKeys": []}]`, "entry 0: address is not 0x-prefixed hex"},
+		{`[{"address": 170, "storageKeys": []}]`, "entry 0: address is not a string"},
+		{`[{"storageKeys": []}]`, "entry 0: address is missing"},
+		{`[{"address": ` + address + `}]`, "entry 0: missing storageKeys"},
+		{`[{"address": ` + address + `, "storageKeys": ` + key + `}]`, "entry 0: storageKeys is not an array"},
+		{`[{"address": ` + address + `, "storageKeys": [], "slots": []}]`, `entry 0: unknown field "slots"`},
+		{`[[` + address + `]]`, "entry 0: expected an object"},
+		{`{"address": ` + address + `}`, "expected an array of"},
+		{"[\n  {\"address\": " + address + " \"storageKeys\": []}\n]", "invalid JSON at line 2, column 60"},
+		{`[{"address": ` + address, "invalid JSON at line 1, column 57"},
+	}
+	for _, test := range tests {
+		_, err := parseAccessList([]byte(test.list))
+		if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.list, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// readArtifact extracts the creation bytecode from a compiled contract
+// artifact. Both the solc/Truffle layout, where "bytecode" is a hex
+// string, and the Foundry layout, where it is {"object": "0x..."}, are
+// understood.
+func readArtifact(path string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var artifact struct {
+		Bytecode json.RawMessage `json:"bytecode"`
+	}
+	if err := json.Unmarshal(contents, &artifact); err != nil {
+		return nil, err
+	}
+	if len(artifact.Bytecode) == 0 {
+		return nil, fmt.Errorf("no bytecode in artifact")
+	}
+
+	var bytecode string
+	if err := json.Unmarshal(artifact.Bytecode, &bytecode); err != nil {
+		var object struct {
+			Object string `json:"object"`
+		}
+		if err := json.Unmarshal(artifact.Bytecode, &object); err != nil {
+			return nil, fmt.Errorf("bytecode is neither a string nor an object")
+		}
+		bytecode = object.Object
+	}
+
+	if strings.Contains(bytecode, "__") {
+		return nil, fmt.Errorf("bytecode has unlinked library references")
+	}
+	code, err := parseHex(bytecode)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, fmt.Errorf("bytecode is empty (is the contract abstract?)")
+	}
+	return code, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/params"
+
+	"runtime"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// capabilityReport describes what this build of ethsign can do, for
+// wrappers that adapt to the installed version.
+type capabilityReport struct {
+	Version            string   `json:"version"`
+	GoEthereum         string   `json:"goEthereum"`
+	Go                 string   `json:"go"`
+	Commands           []string `json:"commands"`
+	TransactionTypes   []string `json:"transactionTypes"`
+	HardwareWallets    []string `json:"hardwareWallets"`
+	HardwareTypedData  bool     `json:"hardwareTypedData"`
+	TypedData          bool     `json:"typedData"`
+	RPC                bool     `json:"rpc"`
+	PassphraseKeychain bool     `json:"passphraseKeychain"`
+}
+
+func capabilities(app *cli.App) capabilityReport {
+	var commands []string
+	for _, command := range app.Commands {
+		commands = append(commands, command.Name)
+	}
+	return capabilityReport{
+		Version:    app.Version,
+		GoEthereum: params.Version,
+		Go:         runtime.Version(),
+		Commands:   commands,
+		// Typed transactions are signed with key files only.
+		TransactionTypes: []string{"legacy", "eip2930", "eip1559"},
+		// Trezors are detected but never searched for accounts, and
+		// hardware wallets sign transactions, and typed data only with
+		// sign-schema on a Ledger.
+		HardwareWallets:    []string{"ledger"},
+		HardwareTypedData:  true,
+		TypedData:          true,
+		RPC:                true,
+		PassphraseKeychain: runtime.GOOS == "darwin" || runtime.GOOS == "linux" || runtime.GOOS == "windows",
+	}
+}
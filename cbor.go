@@ -0,0 +1,164 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"encoding/binary"
+	"fmt"
+)
+
+// CBOR (RFC 7049) major types used for signed transactions.
+const (
+	cborUint  = 0
+	cborBytes = 2
+	cborText  = 3
+	cborMap   = 5
+)
+
+// cborTx is a signed transaction in the compact form written by
+// --out-cbor: a CBOR map of "raw" (the RLP-encoded transaction as a byte
+// string), "from" (20 bytes) and "chainId" (an unsigned integer), with
+// keys in canonical order.
+type cborTx struct {
+	raw     []byte
+	from    common.Address
+	chainID uint64
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return []byte{major<<5 | 25, byte(n >> 8), byte(n)}
+	case n <= 0xffffffff:
+		head := []byte{major<<5 | 26, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(head[1:], uint32(n))
+		return head
+	}
+	head := []byte{major<<5 | 27, 0, 0, 0, 0, 0, 0, 0, 0}
+	binary.BigEndian.PutUint64(head[1:], n)
+	return head
+}
+
+func encodeCBORTx(tx cborTx) []byte {
+	out := cborHead(cborMap, 3)
+	field := func(key string) {
+		out = append(out, cborHead(cborText, uint64(len(key)))...)
+		out = append(out, key...)
+	}
+	field("raw")
+	out = append(out, cborHead(cborBytes, uint64(len(tx.raw)))...)
+	out = append(out, tx.raw...)
+	field("from")
+	out = append(out, cborHead(cborBytes, 20)...)
+	out = append(out, tx.from.Bytes()...)
+	field("chainId")
+	out = append(out, cborHead(cborUint, tx.chainID)...)
+	return out
+}
+
+// cborReader decodes the subset of CBOR that encodeCBORTx writes.
+type cborReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *cborReader) head() (byte, uint64, error) {
+	if r.pos >= len(r.data) {
+		return 0, 0, fmt.Errorf("unexpected end of data")
+	}
+	b := r.data[r.pos]
+	r.pos++
+	major, info := b>>5, b&0x1f
+	if info < 24 {
+		return major, uint64(info), nil
+	}
+	if info > 27 {
+		return 0, 0, fmt.Errorf("unsupported length encoding %d", info)
+	}
+	size := 1 << (info - 24)
+	if r.pos+size > len(r.data) {
+		return 0, 0, fmt.Errorf("unexpected end of data")
+	}
+	var n uint64
+	for _, b := range r.data[r.pos : r.pos+size] {
+		n = n<<8 | uint64(b)
+	}
+	r.pos += size
+	return major, n, nil
+}
+
+func (r *cborReader) bytes(want byte) ([]byte, error) {
+	major, n, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != want {
+		return nil, fmt.Errorf("expected major type %d, got %d", want, major)
+	}
+	if n > uint64(len(r.data)-r.pos) {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+func decodeCBORTx(data []byte) (*cborTx, error) {
+	r := &cborReader{data: data}
+	major, n, err := r.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != cborMap {
+		return nil, fmt.Errorf("expected a map")
+	}
+
+	tx := new(cborTx)
+	seen := make(map[string]bool)
+	for i := uint64(0); i < n; i++ {
+		key, err := r.bytes(cborText)
+		if err != nil {
+			return nil, err
+		}
+		switch string(key) {
+		case "raw":
+			if tx.raw, err = r.bytes(cborBytes); err != nil {
+				return nil, err
+			}
+		case "from":
+			from, err := r.bytes(cborBytes)
+			if err != nil {
+				return nil, err
+			}
+			if len(from) != 20 {
+				return nil, fmt.Errorf("from is %d bytes, not 20", len(from))
+			}
+			tx.from = common.BytesToAddress(from)
+		case "chainId":
+			major, chainID, err := r.head()
+			if err != nil {
+				return nil, err
+			}
+			if major != cborUint {
+				return nil, fmt.Errorf("chainId is not an unsigned integer")
+			}
+			tx.chainID = chainID
+		default:
+			return nil, fmt.Errorf("unknown key %q", key)
+		}
+		seen[string(key)] = true
+	}
+	for _, key := range []string{"raw", "from", "chainId"} {
+		if !seen[key] {
+			return nil, fmt.Errorf("missing %q", key)
+		}
+	}
+	if r.pos != len(data) {
+		return nil, fmt.Errorf("%d bytes of trailing data", len(data)-r.pos)
+	}
+	return tx, nil
+}
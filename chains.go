@@ -0,0 +1,145 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+)
+
+// knownChains maps the chain IDs of well-known networks to their names,
+// including the defaults of local development nodes.
+var knownChains = map[uint64]string{
+	1:        "Ethereum Mainnet",
+	10:       "Optimism",
+	56:       "BNB Smart Chain",
+	100:      "Gnosis",
+	137:      "Polygon",
+	1337:     "local development chain (Geth --dev, Ganache)",
+	8453:     "Base",
+	17000:    "Holesky",
+	31337:    "local development chain (Hardhat, Anvil)",
+	42161:    "Arbitrum One",
+	43114:    "Avalanche C-Chain",
+	11155111: "Sepolia",
+}
+
+// deprecatedChains are networks that have been shut down. They are named
+// in messages but not counted as known, so signing for one needs
+// --allow-future-chain-id.
+var deprecatedChains = map[uint64]string{
+	3: "Ropsten",
+	4: "Rinkeby",
+	5: "Goerli",
+}
+
+// minGasPrices are the minimum gas prices, in wei, that some chains
+// enforce for every transaction. A --network-file can set or override one
+// with minGasPrice.
+var minGasPrices = map[uint64]*big.Int{
+	137: big.NewInt(25000000000), // Polygon PoS: 25 gwei
+}
+
+// minGasPrice returns the chain's minimum gas price from the network
+// definition if it has one, or else from minGasPrices, or nil if there is
+// no floor.
+func minGasPrice(chainID *big.Int, net *network) *big.Int {
+	if net != nil && net.MinGasPrice != nil && net.ChainID != nil && net.ChainID.ToInt().Cmp(chainID) == 0 {
+		return net.MinGasPrice.ToInt()
+	}
+	if !chainID.IsUint64() {
+		return nil
+	}
+	return minGasPrices[chainID.Uint64()]
+}
+
+// chainProfiles are the networks that can be selected by name with
+// --chain, each setting the chain ID, a public RPC URL, the native
+// currency symbol and a block explorer.
+var chainProfiles = map[string]*network{
+	"mainnet":  newProfile(1, "ETH", "https://cloudflare-eth.com", "https://etherscan.io"),
+	"sepolia":  newProfile(11155111, "ETH", "https://rpc.sepolia.org", "https://sepolia.etherscan.io"),
+	"holesky":  newProfile(17000, "ETH", "https://ethereum-holesky-rpc.publicnode.com", "https://holesky.etherscan.io"),
+	"optimism": newProfile(10, "ETH", "https://mainnet.optimism.io", "https://optimistic.etherscan.io"),
+	"arbitrum": newProfile(42161, "ETH", "https://arb1.arbitrum.io/rpc", "https://arbiscan.io"),
+	"base":     newProfile(8453, "ETH", "https://mainnet.base.org", "https://basescan.org"),
+	"polygon":  newProfile(137, "POL", "https://polygon-rpc.com", "https://polygonscan.com"),
+	"gnosis":   newProfile(100, "xDAI", "https://rpc.gnosischain.com", "https://gnosisscan.io"),
+}
+
+func newProfile(chainID uint64, symbol string, rpcURL string, explorer string) *network {
+	net := &network{
+		ChainID:           (*hexutil.Big)(new(big.Int).SetUint64(chainID)),
+		ChainName:         knownChains[chainID],
+		RPCURLs:           []string{rpcURL},
+		BlockExplorerURLs: []string{explorer},
+	}
+	net.NativeCurrency.Name = symbol
+	net.NativeCurrency.Symbol = symbol
+	net.NativeCurrency.Decimals = 18
+	return net
+}
+
+// chainProfile looks up a --chain profile by name.
+func chainProfile(name string) (*network, error) {
+	if net, ok := chainProfiles[name]; ok {
+		return net, nil
+	}
+	var names []string
+	for name := range chainProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("ethsign: unknown --chain %q (known: %s)", name, strings.Join(names, ", "))
+}
+
+// knownChain looks up the name of a well-known chain.
+func knownChain(chainID *big.Int) (string, bool) {
+	if !chainID.IsUint64() {
+		return "", false
+	}
+	name, ok := knownChains[chainID.Uint64()]
+	return name, ok
+}
+
+// deprecatedChain looks up the name of a shut-down chain.
+func deprecatedChain(chainID *big.Int) (string, bool) {
+	if !chainID.IsUint64() {
+		return "", false
+	}
+	name, ok := deprecatedChains[chainID.Uint64()]
+	return name, ok
+}
+
+// chainName returns the name of a well-known or shut-down chain, or a
+// generic description of an unknown one.
+func chainName(chainID *big.Int) string {
+	if name, ok := knownChain(chainID); ok {
+		return name
+	}
+	if name, ok := deprecatedChain(chainID); ok {
+		return name
+	}
+	return fmt.Sprintf("chain %s", chainID)
+}
+
+// checkChainID refuses a chain ID that is not a known network, since it
+// is more likely a typo (11 for 1) than a new chain, unless allowUnknown
+// is set, in which case it only warns. Shut-down networks are not known.
+func checkChainID(chainID *big.Int, allowUnknown bool) error {
+	if _, ok := knownChain(chainID); ok {
+		return nil
+	}
+	what := "is not a known network"
+	if name, ok := deprecatedChain(chainID); ok {
+		what = "is " + name + ", which has been shut down"
+	}
+	if !allowUnknown {
+		return fmt.Errorf("ethsign: chain ID %s %s (use --allow-future-chain-id to sign anyway)", chainID, what)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: chain ID %s %s\n", chainID, what)
+	return nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// config holds settings shared by a team or kept between runs, read from
+// a JSON file such as
+//
+//   {"feePresets": {"turbo": "baseFee*3 + 3gwei", "slow": "baseFee + tip/2"},
+//    "aliases": {"deployer": "0x65c2F08FA0f286A48F8772fa63965ef79ae90f8c"}}
+type config struct {
+	// FeePresets maps preset names to fee expressions; see evalFeeExpr.
+	FeePresets map[string]string `json:"feePresets"`
+	// Aliases maps labels that --from accepts to addresses.
+	Aliases map[string]string `json:"aliases"`
+}
+
+// defaultConfig is where the config is read from unless --config says
+// otherwise.
+func defaultConfig() string {
+	return filepath.Join(os.Getenv("HOME"), ".ethsign", "config.json")
+}
+
+// readConfig reads the file given by --config, or the default config if
+// it exists. A missing default config is an empty one.
+func readConfig(c *cli.Context) (*config, error) {
+	path := c.GlobalString("config")
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfig()
+	}
+
+	conf := &config{}
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !explicit {
+		return conf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// resolveAlias gives the address a --from value stands for: the value
+// itself if it is an address, or else the address of the alias it names.
+func (conf *config) resolveAlias(from string) (common.Address, error) {
+	if common.IsHexAddress(from) {
+		return common.HexToAddress(from), nil
+	}
+	address, ok := conf.Aliases[from]
+	if !ok {
+		return common.Address{}, fmt.Errorf("%q is neither an address nor an alias in the config", from)
+	}
+	if !common.IsHexAddress(address) {
+		return common.Address{}, fmt.Errorf("alias %q is %q, not an address", from, address)
+	}
+	return common.HexToAddress(address), nil
+}
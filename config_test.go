@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"strings"
+	"testing"
+)
+
+func TestResolveAlias(t *testing.T) {
+	conf := &config{Aliases: map[string]string{
+		"deployer": "0x65c2F08FA0f286A48F8772fa63965ef79ae90f8c",
+		"broken":   "0x1234",
+		// An alias cannot shadow an address.
+		"0x0000000000000000000000000000000000000001": "0x65c2F08FA0f286A48F8772fa63965ef79ae90f8c",
+	}}
+
+	tests := []struct {
+		from string
+		want string
+		err  string
+	}{
+		{from: "deployer", want: "0x65c2F08FA0f286A48F8772fa63965ef79ae90f8c"},
+		{from: "0x0000000000000000000000000000000000000001", want: "0x0000000000000000000000000000000000000001"},
+		{from: "65c2f08fa0f286a48f8772fa63965ef79ae90f8c", want: "0x65c2F08FA0f286A48F8772fa63965ef79ae90f8c"},
+		{from: "treasury", err: "neither an address nor an alias"},
+		{from: "broken", err: "not an address"},
+	}
+	for _, test := range tests {
+		got, err := conf.resolveAlias(test.from)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.from, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.from, err)
+		} else if got != common.HexToAddress(test.want) {
+			t.Errorf("%s: got %s, want %s", test.from, got.Hex(), test.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// prompt asks a question on the terminal and returns the answer.
+func prompt(question string) (string, error) {
+	if serving {
+		return "", fmt.Errorf("ethsign: cannot ask for confirmation from serve (use --yes)")
+	}
+	if !stdinIsTerminal() {
+		return "", fmt.Errorf("ethsign: cannot ask for confirmation because stdin is not a terminal (use --yes)")
+	}
+	fmt.Fprintf(os.Stderr, "%s", question)
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("ethsign: failed to read confirmation")
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// chunkAddress splits the checksummed hex of an address into groups of
+// four characters, which are easier to compare by eye.
+func chunkAddress(address common.Address) string {
+	hex := address.Hex()[2:]
+	chunks := []string{"0x"}
+	for i := 0; i < len(hex); i += 4 {
+		chunks = append(chunks, hex[i:i+4])
+	}
+	return strings.Join(chunks, " ")
+}
+
+// confirmAddress shows the recipient and makes the user type the last
+// four characters of its address, as a guard against swapped addresses.
+func confirmAddress(address common.Address) error {
+	fmt.Fprintf(os.Stderr, "Recipient address:\n\n    %s\n\n", chunkAddress(address))
+	answer, err := prompt("Type the last 4 characters of the address to confirm: ")
+	if err != nil {
+		return err
+	}
+	hex := address.Hex()
+	if !strings.EqualFold(answer, hex[len(hex)-4:]) {
+		return fmt.Errorf("ethsign: address confirmation did not match")
+	}
+	return nil
+}
+
+// confirmChainID shows the network being signed for and makes the user
+// type its chain ID, as a guard against testnet/mainnet mixups.
+func confirmChainID(chainID *big.Int) error {
+	fmt.Fprintf(os.Stderr, "Signing for %s (chain ID %s)\n", chainName(chainID), chainID)
+	answer, err := prompt("Type the chain ID to confirm: ")
+	if err != nil {
+		return err
+	}
+	if answer != chainID.String() {
+		return fmt.Errorf("ethsign: chain ID confirmation did not match")
+	}
+	return nil
+}
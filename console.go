@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// stdinIsTerminal reports whether stdin is an interactive terminal. The
+// descriptor is taken from os.Stdin rather than syscall.Stdin, which on
+// Windows is a console handle of a different type. While serving, the
+// terminal belongs to the server, not the client, so it is never used.
+func stdinIsTerminal() bool {
+	return !serving && terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// readPassword shows a prompt on stderr and reads a line from the
+// terminal without echoing it. The terminal package switches the Unix
+// tty or the Windows console mode as needed. Since the Enter key is not
+// echoed either, the prompt line is ended here, and a carriage return
+// left behind by some Windows consoles is dropped.
+func readPassword(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(password), "\r"), nil
+}
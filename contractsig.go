@@ -0,0 +1,326 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// eip1271MagicValue is what a contract's isValidSignature(bytes32,bytes)
+// returns for a signature it accepts (EIP-1271): the function's selector.
+var eip1271MagicValue = []byte{0x16, 0x26, 0xba, 0x7e}
+
+// eip6492Suffix ends a signature wrapped for a contract account that is
+// not deployed yet (EIP-6492).
+var eip6492Suffix = common.FromHex("0x6492649264926492649264926492649264926492649264926492649264926492")
+
+// isValidSignatureCall encodes a call of isValidSignature(hash, sig).
+func isValidSignatureCall(hash []byte, sig []byte) []byte {
+	call := append([]byte{}, eip1271MagicValue...)
+	call = append(call, encodeWords(hash, uint64(64), uint64(len(sig)))...)
+	return append(call, common.RightPadBytes(sig, (len(sig)+31)/32*32)...)
+}
+
+// unwrapEIP6492 splits a signature wrapped by EIP-6492, which is
+// abi.encode(factory, factoryCalldata, signature) followed by the
+// suffix, into the factory that deploys the account, the call that makes
+// it deploy it and the signature for the deployed account.
+func unwrapEIP6492(wrapped []byte) (common.Address, []byte, []byte, error) {
+	if !bytes.HasSuffix(wrapped, eip6492Suffix) {
+		return common.Address{}, nil, nil, fmt.Errorf("signature does not end in the EIP-6492 suffix")
+	}
+	encoded := wrapped[:len(wrapped)-len(eip6492Suffix)]
+	if len(encoded) < 96 {
+		return common.Address{}, nil, nil, fmt.Errorf("EIP-6492 wrapper is too short")
+	}
+	field := func(i int) ([]byte, error) {
+		offset := new(big.Int).SetBytes(encoded[32*i : 32*i+32])
+		if !offset.IsUint64() || offset.Uint64() > uint64(len(encoded)-32) {
+			return nil, fmt.Errorf("EIP-6492 wrapper has an invalid offset")
+		}
+		start := int(offset.Uint64())
+		length := new(big.Int).SetBytes(encoded[start : start+32])
+		if !length.IsUint64() || length.Uint64() > uint64(len(encoded)-start-32) {
+			return nil, fmt.Errorf("EIP-6492 wrapper has an invalid length")
+		}
+		return encoded[start+32 : start+32+int(length.Uint64())], nil
+	}
+	factoryCalldata, err := field(1)
+	if err != nil {
+		return common.Address{}, nil, nil, err
+	}
+	sig, err := field(2)
+	if err != nil {
+		return common.Address{}, nil, nil, err
+	}
+	return common.BytesToAddress(encoded[:32]), factoryCalldata, sig, nil
+}
+
+// eip6492Validator is contract creation code that, run with eth_call,
+// deploys the signer by calling the factory if the signer has no code
+// yet, then returns a word of 1 if the signer's isValidSignature accepts
+// the signature and 0 if not. It reverts if the factory call fails. It
+// is followed by its data: the signer, the factory, the lengths of the
+// factory calldata and the isValidSignature call, and those two.
+var eip6492Validator = []byte{
+	0x61, 0x00, 0xa2, // PUSH2 len(code)
+	0x38,             // CODESIZE
+	0x03,             // SUB
+	0x61, 0x00, 0xa2, // PUSH2 len(code)
+	0x60, 0x00, // PUSH1 0
+	0x39,             // CODECOPY: the data to memory 0
+	0x60, 0x00, 0x51, // signer
+	0x3b,       // EXTCODESIZE
+	0x60, 0x25, // PUSH1 deployed
+	0x57,       // JUMPI
+	0x60, 0x00, // retSize
+	0x80,             // retOffset
+	0x60, 0x40, 0x51, // argsSize: the factory calldata's length
+	0x60, 0x80, // argsOffset
+	0x60, 0x00, // value
+	0x60, 0x20, 0x51, // factory
+	0x5a,       // GAS
+	0xf1,       // CALL
+	0x15,       // ISZERO
+	0x60, 0x9d, // PUSH1 failed
+	0x57,       // JUMPI
+	0x5b,       // deployed: JUMPDEST
+	0x60, 0x20, // retSize
+	0x60, 0x00, // retOffset
+	0x60, 0x60, 0x51, // argsSize: the isValidSignature call's length
+	0x60, 0x40, 0x51, 0x60, 0x80, 0x01, // argsOffset: after the factory calldata
+	0x60, 0x00, 0x51, // signer
+	0x5a,       // GAS
+	0xfa,       // STATICCALL
+	0x15,       // ISZERO
+	0x60, 0x92, // PUSH1 invalid
+	0x57,       // JUMPI
+	0x60, 0x20, // PUSH1 32
+	0x3d,       // RETURNDATASIZE
+	0x10,       // LT
+	0x60, 0x92, // PUSH1 invalid
+	0x57,             // JUMPI
+	0x60, 0x00, 0x51, // the returned word
+	0x7f, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // PUSH32 mask
+	0x16,                                                                                                             // AND
+	0x7f, 0x16, 0x26, 0xba, 0x7e, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // PUSH32 magic value
+	0x14,             // EQ
+	0x60, 0x00, 0x52, // MSTORE
+	0x60, 0x20, 0x60, 0x00, 0xf3, // RETURN the word
+	0x5b,                         // invalid: JUMPDEST
+	0x60, 0x00, 0x60, 0x00, 0x52, // MSTORE 0
+	0x60, 0x20, 0x60, 0x00, 0xf3, // RETURN the word
+	0x5b,                   // failed: JUMPDEST
+	0x60, 0x00, 0x80, 0xfd, // REVERT
+}
+
+// eip6492Creation gives the creation code that checks a signature of a
+// possibly undeployed signer with eip6492Validator.
+func eip6492Creation(signer common.Address, factory common.Address, factoryCalldata []byte, call []byte) []byte {
+	code := append([]byte{}, eip6492Validator...)
+	code = append(code, encodeWords(signer, factory, uint64(len(factoryCalldata)), uint64(len(call)))...)
+	code = append(code, factoryCalldata...)
+	return append(code, call...)
+}
+
+// isValidSignature asks the contract at signer whether it accepts the
+// signature of hash (EIP-1271). A call that reverts is a rejection.
+func (node *rpcNode) isValidSignature(signer common.Address, hash []byte, sig []byte) (bool, error) {
+	result, err := node.ethCall(&signer, isValidSignatureCall(hash, sig))
+	if err != nil {
+		if strings.Contains(err.Error(), "revert") {
+			return false, nil
+		}
+		return false, err
+	}
+	return len(result) >= 4 && bytes.Equal(result[:4], eip1271MagicValue), nil
+}
+
+// isValidSignature6492 checks a signature wrapped by EIP-6492, deploying
+// the signer in a simulated call first if it has no code.
+func (node *rpcNode) isValidSignature6492(signer common.Address, hash []byte, wrapped []byte) (bool, error) {
+	factory, factoryCalldata, sig, err := unwrapEIP6492(wrapped)
+	if err != nil {
+		return false, err
+	}
+	result, err := node.ethCall(nil, eip6492Creation(signer, factory, factoryCalldata, isValidSignatureCall(hash, sig)))
+	if err != nil {
+		if strings.Contains(err.Error(), "revert") {
+			return false, fmt.Errorf("deploying %s with factory %s failed", signer.Hex(), factory.Hex())
+		}
+		return false, err
+	}
+	return len(result) == 32 && result[31] == 1, nil
+}
+
+// verifyContractSignature checks a signature of hash by a contract
+// account: with isValidSignature if the account has code, and for a
+// signature wrapped by EIP-6492, if eip6492 is set, after deploying the
+// account in a simulated call. It reports false, with no error, when the
+// account is not a contract and the signature is not wrapped, for the
+// caller to recover the signer instead.
+func verifyContractSignature(node *rpcNode, signer common.Address, hash []byte, sig []byte, eip6492 bool) (bool, error) {
+	if bytes.HasSuffix(sig, eip6492Suffix) {
+		if !eip6492 {
+			return false, fmt.Errorf("ethsign: the signature is for a contract that is not deployed yet (EIP-6492); verify it with --eip6492")
+		}
+		valid, err := node.isValidSignature6492(signer, hash, sig)
+		if err != nil {
+			return false, fmt.Errorf("ethsign: %v", err)
+		}
+		if !valid {
+			return false, fmt.Errorf("ethsign: %s rejected the signature (EIP-6492)", signer.Hex())
+		}
+		return true, nil
+	}
+
+	code, err := node.code(signer)
+	if err != nil {
+		return false, fmt.Errorf("ethsign: failed to fetch the code of %s: %v", signer.Hex(), err)
+	}
+	if len(code) == 0 {
+		return false, nil
+	}
+	valid, err := node.isValidSignature(signer, hash, sig)
+	if err != nil {
+		return false, fmt.Errorf("ethsign: failed to call isValidSignature on %s: %v", signer.Hex(), err)
+	}
+	if !valid {
+		return false, fmt.Errorf("ethsign: %s rejected the signature (EIP-1271)", signer.Hex())
+	}
+	return true, nil
+}
+
+// safeSignature is one owner's signature in a Safe's packed signatures:
+// R, S and V, where V says how the owner signed. For a contract owner
+// (V of 0) R holds its address and S the offset of its signature, which
+// is read into inner.
+type safeSignature struct {
+	r, s  []byte
+	v     byte
+	inner []byte
+}
+
+// splitSafeSignatures splits signatures packed as a Safe takes its
+// owners': 65 bytes per owner, then the signatures of contract owners,
+// each as a 32-byte length and its bytes. It reports false for a
+// signature that is not packed that way.
+func splitSafeSignatures(sig []byte) ([]safeSignature, bool) {
+	var entries []safeSignature
+	end := len(sig)
+	for pos := 0; pos < end; pos += 65 {
+		if pos+65 > end {
+			return nil, false
+		}
+		e := safeSignature{r: sig[pos : pos+32], s: sig[pos+32 : pos+64], v: sig[pos+64]}
+		switch {
+		case e.v == 0:
+			offset := new(big.Int).SetBytes(e.s)
+			if !offset.IsUint64() || offset.Uint64() < uint64(pos+65) || offset.Uint64()+32 > uint64(len(sig)) {
+				return nil, false
+			}
+			start := int(offset.Uint64())
+			length := new(big.Int).SetBytes(sig[start : start+32])
+			if !length.IsUint64() || length.Uint64() > uint64(len(sig)-start-32) {
+				return nil, false
+			}
+			e.inner = sig[start+32 : start+32+int(length.Uint64())]
+			if start < end {
+				end = start
+			}
+		case e.v == 1, e.v == 27, e.v == 28, e.v == 31, e.v == 32:
+		default:
+			return nil, false
+		}
+		entries = append(entries, e)
+	}
+	return entries, len(entries) > 0
+}
+
+// verifyRecursive is verifyContractSignature for contract accounts owned
+// by other contracts, as a Safe owned by Safes is. Once the signer
+// accepts the signature, each contract owner's signature packed in it is
+// checked with that owner's isValidSignature for the same hash, as Safe
+// 1.5 asks its contract owners, down to maxDepth levels of nesting and
+// refusing an owner that owns itself through others. Every signer found
+// is printed to w, indented by its depth.
+func verifyRecursive(node *rpcNode, signer common.Address, hash []byte, sig []byte, eip6492 bool, maxDepth int, w io.Writer) (bool, error) {
+	var walk func(signer common.Address, sig []byte, path []common.Address) error
+	walk = func(signer common.Address, sig []byte, path []common.Address) error {
+		for _, owner := range path {
+			if owner == signer {
+				var chain []string
+				for _, a := range append(path, signer) {
+					chain = append(chain, a.Hex())
+				}
+				return fmt.Errorf("ethsign: signers form a cycle: %s", strings.Join(chain, " -> "))
+			}
+		}
+		if len(path) > maxDepth {
+			return fmt.Errorf("ethsign: %s is nested more than %d levels deep; raise --max-depth to follow it", signer.Hex(), maxDepth)
+		}
+		indent := strings.Repeat("  ", len(path))
+
+		if len(path) > 0 {
+			code, err := node.code(signer)
+			if err != nil {
+				return fmt.Errorf("ethsign: failed to fetch the code of %s: %v", signer.Hex(), err)
+			}
+			if len(code) == 0 {
+				return fmt.Errorf("ethsign: %s signs for %s as a contract but has no code", signer.Hex(), path[len(path)-1].Hex())
+			}
+			valid, err := node.isValidSignature(signer, hash, sig)
+			if err != nil {
+				return fmt.Errorf("ethsign: failed to call isValidSignature on %s: %v", signer.Hex(), err)
+			}
+			if !valid {
+				return fmt.Errorf("ethsign: %s rejected its signature for %s (EIP-1271)", signer.Hex(), path[len(path)-1].Hex())
+			}
+		}
+		fmt.Fprintf(w, "%s%s: contract, accepts the signature\n", indent, signer.Hex())
+
+		entries, ok := splitSafeSignatures(sig)
+		if !ok {
+			return nil
+		}
+		owners := append(path[:len(path):len(path)], signer)
+		for _, e := range entries {
+			owner := common.BytesToAddress(e.r)
+			switch e.v {
+			case 0:
+				if err := walk(owner, e.inner, owners); err != nil {
+					return err
+				}
+			case 1:
+				fmt.Fprintf(w, "%s  %s: approved the hash on chain\n", indent, owner.Hex())
+			case 27, 28:
+				pub, err := crypto.Ecrecover(hash, append(append(append([]byte{}, e.r...), e.s...), e.v-27))
+				if err != nil {
+					return fmt.Errorf("ethsign: invalid signature of an owner of %s: %v", signer.Hex(), err)
+				}
+				fmt.Fprintf(w, "%s  %s: signed\n", indent, common.BytesToAddress(crypto.Keccak256(pub[1:])[12:]).Hex())
+			default:
+				owner, err := recover(hash, append(append(append([]byte{}, e.r...), e.s...), e.v-4))
+				if err != nil {
+					return fmt.Errorf("ethsign: invalid signature of an owner of %s: %v", signer.Hex(), err)
+				}
+				fmt.Fprintf(w, "%s  %s: signed with eth_sign\n", indent, owner.Hex())
+			}
+		}
+		return nil
+	}
+
+	verified, err := verifyContractSignature(node, signer, hash, sig, eip6492)
+	if err != nil || !verified {
+		return verified, err
+	}
+	if bytes.HasSuffix(sig, eip6492Suffix) {
+		_, _, sig, _ = unwrapEIP6492(sig)
+	}
+	return true, walk(signer, sig, nil)
+}
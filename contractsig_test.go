@@ -0,0 +1,306 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm/runtime"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wrap6492 wraps a signature for an undeployed account as EIP-6492 does.
+func wrap6492(factory common.Address, factoryCalldata []byte, sig []byte) []byte {
+	padded := func(b []byte) []byte {
+		return append(encodeWords(uint64(len(b))), common.RightPadBytes(b, (len(b)+31)/32*32)...)
+	}
+	calldata := padded(factoryCalldata)
+	wrapped := encodeWords(factory, uint64(96), uint64(96+len(calldata)))
+	wrapped = append(wrapped, calldata...)
+	wrapped = append(wrapped, padded(sig)...)
+	return append(wrapped, eip6492Suffix...)
+}
+
+func TestUnwrapEIP6492(t *testing.T) {
+	factory := common.HexToAddress("0x00000000000000000000000000000000000000fa")
+	calldata := bytes.Repeat([]byte{0xcd}, 36)
+	sig := bytes.Repeat([]byte{0xab}, 65)
+
+	gotFactory, gotCalldata, gotSig, err := unwrapEIP6492(wrap6492(factory, calldata, sig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotFactory != factory || !bytes.Equal(gotCalldata, calldata) || !bytes.Equal(gotSig, sig) {
+		t.Errorf("got %s, %x and %x", gotFactory.Hex(), gotCalldata, gotSig)
+	}
+
+	wrapped := wrap6492(factory, calldata, sig)
+	tests := []struct {
+		name    string
+		wrapped []byte
+		err     string
+	}{
+		{"no suffix", sig, "suffix"},
+		{"short", append(make([]byte, 64), eip6492Suffix...), "too short"},
+		{"offset", append(encodeWords(factory, uint64(96), uint64(4096)), wrapped[96:]...), "invalid offset"},
+		{"length", append(append(wrapped[:96:96], encodeWords(uint64(4096))...), wrapped[128:]...), "invalid length"},
+	}
+	for _, test := range tests {
+		if _, _, _, err := unwrapEIP6492(test.wrapped); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+// TestEIP6492Validator runs the validator's creation code against a
+// factory that deploys a wallet whose isValidSignature accepts any
+// signature starting with a word of 1.
+func TestEIP6492Validator(t *testing.T) {
+	// The wallet's runtime code returns the magic value times
+	// (calldataload(100) == 1), where 100 is where the signature starts.
+	wallet := append([]byte{0x60, 0x64, 0x35, 0x60, 0x01, 0x14, 0x7f}, common.RightPadBytes(eip1271MagicValue, 32)...)
+	wallet = append(wallet, 0x02, 0x60, 0x00, 0x52, 0x60, 0x20, 0x60, 0x00, 0xf3)
+	walletCreation := append([]byte{0x60, byte(len(wallet)), 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}, wallet...)
+
+	// The factory creates a contract from its calldata; the broken one
+	// reverts and the lazy one does nothing.
+	deploying := []byte{0x36, 0x60, 0x00, 0x60, 0x00, 0x37, 0x36, 0x60, 0x00, 0x60, 0x00, 0xf0, 0x00}
+	reverting := []byte{0x60, 0x00, 0x80, 0xfd}
+	lazy := []byte{0x00}
+
+	factory := common.HexToAddress("0x00000000000000000000000000000000000000fa")
+	signer := crypto.CreateAddress(factory, 0)
+	hash := crypto.Keccak256([]byte("hello"))
+	valid := append(common.LeftPadBytes([]byte{1}, 32), make([]byte, 33)...)
+	invalid := append(common.LeftPadBytes([]byte{2}, 32), make([]byte, 33)...)
+
+	tests := []struct {
+		name     string
+		factory  []byte
+		deployed bool
+		sig      []byte
+		want     byte
+		err      bool
+	}{
+		{name: "undeployed", factory: deploying, sig: valid, want: 1},
+		{name: "undeployed, rejected", factory: deploying, sig: invalid, want: 0},
+		{name: "deployed", factory: reverting, deployed: true, sig: valid, want: 1},
+		{name: "deployed, rejected", factory: reverting, deployed: true, sig: invalid, want: 0},
+		{name: "factory fails", factory: reverting, sig: valid, err: true},
+		{name: "factory deploys nothing", factory: lazy, sig: valid, want: 0},
+	}
+	for _, test := range tests {
+		db, _ := ethdb.NewMemDatabase()
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+		statedb.SetCode(factory, test.factory)
+		if test.deployed {
+			statedb.SetCode(signer, wallet)
+		}
+		cfg := &runtime.Config{ChainConfig: params.AllEthashProtocolChanges, State: statedb, GasLimit: 10000000}
+
+		ret, _, err := runtime.Execute(eip6492Creation(signer, factory, walletCreation, isValidSignatureCall(hash, test.sig)), nil, cfg)
+		switch {
+		case test.err:
+			if err == nil {
+				t.Errorf("%s: no error", test.name)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", test.name, err)
+		case len(ret) != 32 || ret[31] != test.want:
+			t.Errorf("%s: got %x, want %d", test.name, ret, test.want)
+		}
+	}
+}
+
+func TestVerifyContractSignature(t *testing.T) {
+	signer := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	factory := common.HexToAddress("0x00000000000000000000000000000000000000fa")
+	hash := crypto.Keccak256([]byte("hello"))
+	sig := bytes.Repeat([]byte{0xab}, 65)
+	wrapped := wrap6492(factory, []byte{0x01}, sig)
+	word := func(b ...byte) string {
+		return hexutil.Encode(common.RightPadBytes(b, 32))
+	}
+
+	tests := []struct {
+		name     string
+		results  map[string]interface{}
+		sig      []byte
+		eip6492  bool
+		verified bool
+		err      string
+	}{
+		{name: "not a contract", results: map[string]interface{}{"eth_getCode": "0x"}, sig: sig},
+		{name: "accepted", results: map[string]interface{}{"eth_getCode": "0x6000", "eth_call": word(0x16, 0x26, 0xba, 0x7e)}, sig: sig, verified: true},
+		{name: "rejected", results: map[string]interface{}{"eth_getCode": "0x6000", "eth_call": word(0xff, 0xff, 0xff, 0xff)}, sig: sig, err: "rejected the signature (EIP-1271)"},
+		{name: "short answer", results: map[string]interface{}{"eth_getCode": "0x6000", "eth_call": "0x"}, sig: sig, err: "rejected"},
+		{name: "wrapped", results: map[string]interface{}{"eth_call": hexutil.Encode(common.LeftPadBytes([]byte{1}, 32))}, sig: wrapped, eip6492: true, verified: true},
+		{name: "wrapped, rejected", results: map[string]interface{}{"eth_call": word()}, sig: wrapped, eip6492: true, err: "rejected the signature (EIP-6492)"},
+		{name: "wrapped without --eip6492", results: map[string]interface{}{}, sig: wrapped, err: "--eip6492"},
+		{name: "no code", results: map[string]interface{}{}, sig: sig, err: "failed to fetch the code"},
+	}
+	for _, test := range tests {
+		node, err := dialNode(fakeNode(t, test.results), time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verified, err := verifyContractSignature(node, signer, hash, test.sig, test.eip6492)
+		node.close()
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if verified != test.verified {
+			t.Errorf("%s: got verified %v, want %v", test.name, verified, test.verified)
+		}
+	}
+}
+
+// packSafeSignatures packs signatures as a Safe takes them: a contract
+// owner's R holds its address and S the offset of its signature, which
+// follows the 65-byte entries.
+func packSafeSignatures(entries [][]byte, inner map[int][]byte) []byte {
+	var static, dynamic []byte
+	for i, e := range entries {
+		if sig, ok := inner[i]; ok {
+			offset := uint64(65*len(entries) + len(dynamic))
+			e = append(encodeWords(common.BytesToAddress(e), offset), 0)
+			dynamic = append(dynamic, encodeWords(uint64(len(sig)))...)
+			dynamic = append(dynamic, sig...)
+		}
+		static = append(static, e...)
+	}
+	return append(static, dynamic...)
+}
+
+// contractChain answers eth_getCode and eth_call for the contracts in
+// accepts, which accept a signature for isValidSignature if it says so.
+func contractChain(accepts map[common.Address]bool) map[string]interface{} {
+	return map[string]interface{}{
+		"eth_getCode": fakeResult(func(params []json.RawMessage) interface{} {
+			var account common.Address
+			json.Unmarshal(params[0], &account)
+			if _, ok := accepts[account]; ok {
+				return "0x6000"
+			}
+			return "0x"
+		}),
+		"eth_call": fakeResult(func(params []json.RawMessage) interface{} {
+			var args struct {
+				To common.Address `json:"to"`
+			}
+			json.Unmarshal(params[0], &args)
+			if accepts[args.To] {
+				return hexutil.Encode(common.RightPadBytes(eip1271MagicValue, 32))
+			}
+			return hexutil.Encode(common.RightPadBytes([]byte{0xff, 0xff, 0xff, 0xff}, 32))
+		}),
+	}
+}
+
+func TestVerifyRecursive(t *testing.T) {
+	safe := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	owner := common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	hash := crypto.Keccak256([]byte("hello"))
+
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	key3, _ := crypto.GenerateKey()
+	sig1, _ := crypto.Sign(hash, key1)
+	sig1[64] += 27
+	sig2, _ := crypto.Sign(signHash(hash), key2)
+	sig2[64] += 31
+	sig3, _ := crypto.Sign(hash, key3)
+	sig3[64] += 27
+
+	sig := packSafeSignatures([][]byte{owner.Bytes(), sig1, sig2}, map[int][]byte{0: sig3})
+	cyclic := packSafeSignatures([][]byte{owner.Bytes(), sig1}, map[int][]byte{0: packSafeSignatures([][]byte{safe.Bytes()}, map[int][]byte{0: sig3})})
+
+	tests := []struct {
+		name     string
+		accepts  map[common.Address]bool
+		sig      []byte
+		maxDepth int
+		verified bool
+		out      string
+		err      string
+	}{
+		{
+			name:     "nested",
+			accepts:  map[common.Address]bool{safe: true, owner: true},
+			sig:      sig,
+			maxDepth: 4,
+			verified: true,
+			out: safe.Hex() + ": contract, accepts the signature\n" +
+				"  " + owner.Hex() + ": contract, accepts the signature\n" +
+				"    " + crypto.PubkeyToAddress(key3.PublicKey).Hex() + ": signed\n" +
+				"  " + crypto.PubkeyToAddress(key1.PublicKey).Hex() + ": signed\n" +
+				"  " + crypto.PubkeyToAddress(key2.PublicKey).Hex() + ": signed with eth_sign\n",
+		},
+		{name: "not a contract", accepts: map[common.Address]bool{}, sig: sig, maxDepth: 4},
+		{name: "rejected", accepts: map[common.Address]bool{safe: false}, sig: sig, maxDepth: 4, err: "rejected the signature (EIP-1271)"},
+		{name: "owner rejects", accepts: map[common.Address]bool{safe: true, owner: false}, sig: sig, maxDepth: 4, err: "rejected its signature for " + safe.Hex()},
+		{name: "owner has no code", accepts: map[common.Address]bool{safe: true}, sig: sig, maxDepth: 4, err: "has no code"},
+		{name: "too deep", accepts: map[common.Address]bool{safe: true, owner: true}, sig: sig, maxDepth: 0, err: "more than 0 levels"},
+		{name: "cycle", accepts: map[common.Address]bool{safe: true, owner: true}, sig: cyclic, maxDepth: 4, err: "cycle: " + safe.Hex() + " -> " + owner.Hex() + " -> " + safe.Hex()},
+		{name: "opaque", accepts: map[common.Address]bool{safe: true}, sig: []byte{0x01, 0x02}, maxDepth: 4, verified: true, out: safe.Hex() + ": contract, accepts the signature\n"},
+	}
+	for _, test := range tests {
+		node, err := dialNode(fakeNode(t, contractChain(test.accepts)), time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		verified, err := verifyRecursive(node, safe, hash, test.sig, false, test.maxDepth, &out)
+		node.close()
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if verified != test.verified || out.String() != test.out {
+			t.Errorf("%s: got verified %v and\n%s\nwant %v and\n%s", test.name, verified, out.String(), test.verified, test.out)
+		}
+	}
+}
+
+func TestSplitSafeSignatures(t *testing.T) {
+	sig := bytes.Repeat([]byte{0x11}, 65)
+	sig[64] = 27
+	tests := []struct {
+		name string
+		sig  []byte
+		n    int
+	}{
+		{"one owner", sig, 1},
+		{"two owners", append(append([]byte{}, sig...), sig...), 2},
+		{"contract owner", packSafeSignatures([][]byte{make([]byte, 20), sig}, map[int][]byte{0: sig}), 2},
+		{"empty", nil, 0},
+		{"short", sig[:64], 0},
+		{"unknown V", append(sig[:64:64], 5), 0},
+		{"offset inside the entries", append(encodeWords(common.Address{}, uint64(10)), 0), 0},
+		{"offset past the end", append(encodeWords(common.Address{}, uint64(65)), 0), 0},
+	}
+	for _, test := range tests {
+		entries, ok := splitSafeSignatures(test.sig)
+		if ok != (test.n > 0) || len(entries) != test.n {
+			t.Errorf("%s: got %d entries and %v, want %d", test.name, len(entries), ok, test.n)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+
+	"time"
+)
+
+// stateDump is an inventory of every wallet ethsign can see and the
+// accounts in it. It holds no secrets.
+type stateDump struct {
+	GeneratedAt string       `json:"generatedAt"`
+	Wallets     []dumpWallet `json:"wallets"`
+}
+
+type dumpWallet struct {
+	URL      string        `json:"url"`
+	Kind     string        `json:"kind"`
+	Status   string        `json:"status"`
+	Accounts []dumpAccount `json:"accounts"`
+}
+
+// dumpAccount is an account with its key file for keystore accounts, or
+// its derivation path for hardware wallet accounts.
+type dumpAccount struct {
+	Address common.Address `json:"address"`
+	KeyFile string         `json:"keyFile,omitempty"`
+	Path    string         `json:"path,omitempty"`
+}
+
+// dumpState describes the wallets, deriving the first four addresses of
+// each Ledger as list-accounts does.
+func dumpState(wallets []accounts.Wallet, now time.Time) (*stateDump, error) {
+	dump := &stateDump{GeneratedAt: now.UTC().Format(time.RFC3339), Wallets: []dumpWallet{}}
+	for _, wallet := range wallets {
+		status, _ := wallet.Status()
+		entry := dumpWallet{
+			URL:      wallet.URL().String(),
+			Kind:     wallet.URL().Scheme,
+			Status:   status,
+			Accounts: []dumpAccount{},
+		}
+
+		switch wallet.URL().Scheme {
+		case "keystore":
+			for _, acct := range wallet.Accounts() {
+				entry.Accounts = append(entry.Accounts, dumpAccount{Address: acct.Address, KeyFile: acct.URL.Path})
+			}
+		case "ledger":
+			wallet.Open("")
+			for _, pathstr := range ledgerPaths {
+				path, _ := accounts.ParseDerivationPath(pathstr)
+				acct, err := wallet.Derive(path, false)
+				if err != nil {
+					return nil, ledgerError(wallet, err)
+				}
+				entry.Accounts = append(entry.Accounts, dumpAccount{Address: acct.Address, Path: pathstr})
+			}
+		}
+
+		dump.Wallets = append(dump.Wallets, entry)
+	}
+	return dump, nil
+}
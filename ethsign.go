@@ -4,6 +4,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/accounts/usbwallet"
@@ -13,14 +14,23 @@ import (
 
 	"os"
 	"fmt"
+	"encoding/base64"
+	"encoding/json"
+	"bytes"
+	"math/big"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
 	"io/ioutil"
 	"strings"
-	"syscall"
+	"sync"
 	"runtime"
+	"time"
 	
 	"gopkg.in/urfave/cli.v1"
 
-	"golang.org/x/crypto/ssh/terminal"
+	"golang.org/x/crypto/sha3"
 )
 
 // https://github.com/ethereum/go-ethereum/blob/55599ee95d4151a2502465e0afc7c47bd1acba77/internal/ethapi/api.go#L404
@@ -32,19 +42,120 @@ import (
 //
 // This gives context to the signed message and prevents signing of transactions.
 func signHash(data []byte) []byte {
-	msg := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(data), data)
-	return crypto.Keccak256([]byte(msg))
+	return crypto.Keccak256(signPreimage(data))
+}
+
+// signPreimage returns the bytes that signHash hashes.
+func signPreimage(data []byte) []byte {
+	return []byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(data), data))
+}
+
+// validatorPreimage returns the EIP-191 version 0x00 preimage for data
+// meant for the given validator contract: 0x19 || 0x00 || validator ||
+// data, with no length field.
+func validatorPreimage(validator common.Address, data []byte) []byte {
+	preimage := append([]byte{0x19, 0x00}, validator.Bytes()...)
+	return append(preimage, data...)
+}
+
+// compactSignature packs a 65-byte [R || S || V] signature, with V as 0 or 1,
+// into the 64-byte EIP-2098 form [R || yParityAndS].
+func compactSignature(sig []byte) []byte {
+	compact := make([]byte, 64)
+	copy(compact, sig[:64])
+	compact[32] |= sig[64] << 7
+	return compact
+}
+
+// expandSignature unpacks a 64-byte EIP-2098 signature into the 65-byte
+// [R || S || V] form, with V as 27 or 28.
+func expandSignature(compact []byte) []byte {
+	sig := make([]byte, 65)
+	copy(sig, compact)
+	sig[32] &= 0x7f
+	sig[64] = 27 + compact[32]>>7
+	return sig
+}
+
+// appendNonce appends a nonce and an issue time to a message so that its
+// signature cannot be replayed, as
+//
+//   message + "\nNonce: " + hex(nonce) + "\nIssued At: " + RFC 3339 UTC time
+//
+// The hex has no 0x prefix and the time has one-second precision.
+func appendNonce(message []byte, nonce []byte, issuedAt time.Time) []byte {
+	suffix := fmt.Sprintf("\nNonce: %x\nIssued At: %s", nonce, issuedAt.UTC().Format(time.RFC3339))
+	return append(append([]byte{}, message...), suffix...)
+}
+
+// parseHex decodes hex input, with or without a 0x or 0X prefix, in any
+// mix of upper and lower case and ignoring surrounding whitespace, so
+// that every spelling of the same bytes decodes alike.
+func parseHex(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+	if !strings.HasPrefix(s, "0x") {
+		s = "0x" + s
+	}
+	return parseStrictHex(s)
+}
+
+// parseStrictHex decodes hex input for --strict-hex, which must be
+// exactly as written: a lowercase 0x prefix, no surrounding whitespace
+// and an even number of digits.
+func parseStrictHex(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, "0x") {
+		return nil, fmt.Errorf("hex must start with 0x")
+	}
+	if len(s)%2 != 0 {
+		return nil, fmt.Errorf("hex must have an even number of digits")
+	}
+	return hexutil.Decode(s)
+}
+
+// decodeData decodes input given as hex, plain text or base64.
+func decodeData(s string, encoding string) ([]byte, error) {
+	switch encoding {
+	case "hex":
+		return parseHex(s)
+	case "text":
+		return []byte(s), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return nil, fmt.Errorf("unknown encoding %q (want hex, text or base64)", encoding)
+}
+
+// encodeData is the inverse of decodeData.
+func encodeData(data []byte, encoding string) string {
+	switch encoding {
+	case "text":
+		return string(data)
+	case "base64":
+		return base64.StdEncoding.EncodeToString(data)
+	}
+	return hexutil.Encode(data)
 }
 
 // https://github.com/ethereum/go-ethereum/blob/55599ee95d4151a2502465e0afc7c47bd1acba77/internal/ethapi/api.go#L442
+//
+// V may be 27/28 or 0/1, as message --v-encoding makes either.
 func recover(data []byte, sig hexutil.Bytes) (common.Address, error) {
+	if len(sig) == 64 {
+		sig = expandSignature(sig)
+	}
 	if len(sig) != 65 {
-		return common.Address{}, fmt.Errorf("signature must be 65 bytes long")
+		return common.Address{}, fmt.Errorf("signature must be 64 or 65 bytes long")
 	}
-	if sig[64] != 27 && sig[64] != 28 {
-		return common.Address{}, fmt.Errorf("invalid Ethereum signature (V is not 27 or 28)")
+	sig = append(hexutil.Bytes{}, sig...)
+	if sig[64] == 27 || sig[64] == 28 {
+		sig[64] -= 27 // Transform yellow paper V from 27/28 to 0/1
+	}
+	if sig[64] != 0 && sig[64] != 1 {
+		return common.Address{}, fmt.Errorf("invalid Ethereum signature (V is not 0, 1, 27 or 28)")
 	}
-	sig[64] -= 27 // Transform yellow paper V from 27/28 to 0/1
 
 	rpk, err := crypto.Ecrecover(signHash(data), sig)
 	if err != nil {
@@ -55,6 +166,433 @@ func recover(data []byte, sig hexutil.Bytes) (common.Address, error) {
 	return recoveredAddr, nil
 }
 
+// findAccount scans the wallets for the account with the given address.
+// For hardware accounts it also returns the derivation path that
+// matched. Ledgers are searched without pinning the accounts they derive.
+//
+// If the address is in more than one kind of wallet, prefer must name
+// the kind to use: keystore, ledger, or hardware for any hardware wallet.
+// Ledgers are only required to answer when no key store has the account
+// or prefer asks for one; otherwise they are only checked for conflicts,
+// so that a locked or unplugged Ledger does not stop keystore signing.
+func findAccount(wallets []accounts.Wallet, from common.Address, prefer string) (accounts.Wallet, *accounts.Account, string, error) {
+	type match struct {
+		wallet  accounts.Wallet
+		account accounts.Account
+		path    string
+	}
+	var matches []match
+
+	for _, x := range wallets {
+		if x.URL().Scheme == "keystore" {
+			for _, y := range x.Accounts() {
+				if y.Address == from {
+					matches = append(matches, match{x, y, ""})
+				}
+			}
+		}
+	}
+
+	if prefer != "keystore" {
+		required := len(matches) == 0 || prefer != ""
+		for _, x := range wallets {
+			if x.URL().Scheme != "ledger" {
+				continue
+			}
+			x.Open("")
+			for _, pathstr := range ledgerPaths {
+				path, _ := accounts.ParseDerivationPath(pathstr)
+				y, err := x.Derive(path, false)
+				if err != nil {
+					if required {
+						return nil, nil, "", ledgerError(x, err)
+					}
+					break
+				}
+				if y.Address == from {
+					matches = append(matches, match{x, y, pathstr})
+					break
+				}
+			}
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, nil, "", fmt.Errorf("ethsign: account not found")
+	}
+
+	var schemes []string
+	for _, m := range matches {
+		scheme := m.wallet.URL().Scheme
+		if len(schemes) == 0 || schemes[len(schemes)-1] != scheme {
+			schemes = append(schemes, scheme)
+		}
+	}
+
+	if prefer == "" {
+		if len(schemes) > 1 {
+			return nil, nil, "", fmt.Errorf("ethsign: %s is in %s wallets; choose one with --prefer", from.Hex(), strings.Join(schemes, " and "))
+		}
+		return matches[0].wallet, &matches[0].account, matches[0].path, nil
+	}
+	for _, m := range matches {
+		scheme := m.wallet.URL().Scheme
+		if scheme == prefer || (prefer == "hardware" && scheme != "keystore") {
+			return m.wallet, &m.account, m.path, nil
+		}
+	}
+	return nil, nil, "", fmt.Errorf("ethsign: account not found in %s wallets", prefer)
+}
+
+// ledgerPaths are the derivation paths searched for accounts on a
+// Ledger, in order.
+var ledgerPaths = []string{
+	"m/44'/60'/0'/0",
+	"m/44'/60'/0'/1",
+	"m/44'/60'/0'/2",
+	"m/44'/60'/0'/3",
+}
+
+// getWallets opens the key stores given with --key-store, or the default
+// ones, and unless usb is false any connected USB hardware wallets.
+func getWallets(c *cli.Context, defaultKeyStores []string, usb bool) []accounts.Wallet {
+	backends := []accounts.Backend{}
+
+	paths := c.StringSlice("key-store")
+	if len(paths) == 0 {
+		paths = defaultKeyStores
+	}
+
+	key := fmt.Sprint(paths, usb)
+	if wallets, ok := walletCache[key]; ok {
+		return wallets
+	}
+	// Key stores are scanned and USB buses probed concurrently, each into
+	// its own slot, so the order of backends does not depend on which
+	// finishes first.
+	var wg sync.WaitGroup
+	slots := make([]accounts.Backend, len(paths)+2)
+	for i, x := range paths {
+		wg.Add(1)
+		go func(i int, x string) {
+			defer wg.Done()
+			slots[i] = keystore.NewKeyStore(
+				x, keystore.StandardScryptN, keystore.StandardScryptP)
+		}(i, x)
+	}
+
+	if usb {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
+				fmt.Fprintf(os.Stderr, "ethsign: failed to look for USB Ledgers")
+			} else {
+				slots[len(paths)] = ledgerhub
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if trezorhub, err := usbwallet.NewTrezorHub(); err != nil {
+				fmt.Fprintf(os.Stderr, "ethsign: failed to look for USB Trezors")
+			} else {
+				slots[len(paths)+1] = trezorhub
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, backend := range slots {
+		if backend != nil {
+			backends = append(backends, backend)
+		}
+	}
+
+	wallets := accounts.NewManager(backends...).Wallets()
+	if walletCache != nil {
+		walletCache[key] = wallets
+	}
+	return wallets
+}
+
+// getPassphrase reads the account passphrase from --passphrase-file,
+// --passphrase-stdin or --passphrase-keychain if given, and otherwise
+// prompts for it on the terminal.
+func getPassphrase(c *cli.Context) (string, error) {
+	sources := 0
+	for _, given := range []bool{c.String("passphrase-file") != "", c.Bool("passphrase-stdin"), c.String("passphrase-keychain") != ""} {
+		if given {
+			sources++
+		}
+	}
+	if sources > 1 {
+		return "", fmt.Errorf("ethsign: use only one of --passphrase-file, --passphrase-stdin and --passphrase-keychain")
+	}
+
+	if c.String("passphrase-keychain") != "" {
+		return keychainPassphrase(c.String("passphrase-keychain"))
+	}
+
+	if serving && c.Bool("passphrase-stdin") {
+		return "", fmt.Errorf("ethsign: serve cannot read --passphrase-stdin; use --passphrase-file or --passphrase-keychain")
+	}
+
+	if c.Bool("passphrase-stdin") {
+		line, err := stdin.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return "", fmt.Errorf("ethsign: failed to read passphrase from stdin")
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	if c.String("passphrase-file") != "" {
+		passphraseFile, err := ioutil.ReadFile(c.String("passphrase-file"))
+		if err != nil {
+			return "", fmt.Errorf("ethsign: failed to read passphrase file")
+		}
+		return strings.TrimSuffix(string(passphraseFile), "\n"), nil
+	}
+
+	if serving {
+		return "", fmt.Errorf("ethsign: serve cannot prompt for a passphrase; use --passphrase-file or --passphrase-keychain")
+	}
+
+	if !stdinIsTerminal() {
+		return "", fmt.Errorf("ethsign: no passphrase source available and stdin is not a terminal (use --passphrase-file or --passphrase-stdin)")
+	}
+
+	passphrase, err := readPassword("Ethereum account passphrase (not echoed): ")
+	if err != nil {
+		return "", fmt.Errorf("ethsign: failed to read passphrase")
+	}
+	return passphrase, nil
+}
+
+// getNewPassphrase reads the passphrase for a new key like getPassphrase,
+// but when prompting asks twice and checks that both answers match.
+func getNewPassphrase(c *cli.Context) (string, error) {
+	if c.String("passphrase-file") != "" || c.Bool("passphrase-stdin") || c.String("passphrase-keychain") != "" {
+		return getPassphrase(c)
+	}
+
+	if serving {
+		return "", fmt.Errorf("ethsign: serve cannot prompt for a passphrase; use --passphrase-file or --passphrase-keychain")
+	}
+
+	if !stdinIsTerminal() {
+		return "", fmt.Errorf("ethsign: no passphrase source available and stdin is not a terminal (use --passphrase-file or --passphrase-stdin)")
+	}
+
+	passphrase, err := readPassword("Passphrase for the new key (not echoed): ")
+	if err != nil {
+		return "", fmt.Errorf("ethsign: failed to read passphrase")
+	}
+	confirmation, err := readPassword("Repeat passphrase: ")
+	if err != nil {
+		return "", fmt.Errorf("ethsign: failed to read passphrase")
+	}
+	if passphrase != confirmation {
+		return "", fmt.Errorf("ethsign: passphrases do not match")
+	}
+	return passphrase, nil
+}
+
+// applyFromAlias replaces a --from label with the address the config
+// gives it.
+func applyFromAlias(c *cli.Context) error {
+	if c.String("from") == "" || common.IsHexAddress(c.String("from")) {
+		return nil
+	}
+	conf, err := readConfig(c)
+	if err != nil {
+		return fmt.Errorf("ethsign: failed to read --config: %v", err)
+	}
+	address, err := conf.resolveAlias(c.String("from"))
+	if err != nil {
+		return fmt.Errorf("ethsign: invalid --from: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "Using %s for %s\n", address.Hex(), c.String("from"))
+	c.Set("from", address.Hex())
+	return nil
+}
+
+// applyFrom resolves a --from alias and fills in --from from --from-uuid,
+// or when neither is given and the only wallets are key stores holding a
+// single account, with that account.
+func applyFrom(c *cli.Context, defaultKeyStores []string) error {
+	if err := applyFromAlias(c); err != nil {
+		return err
+	}
+	if c.String("from-uuid") != "" {
+		return applyFromUUID(c, defaultKeyStores)
+	}
+	if c.String("from") != "" {
+		return nil
+	}
+
+	var only *common.Address
+	for _, x := range getWallets(c, defaultKeyStores, true) {
+		if x.URL().Scheme != "keystore" {
+			return nil
+		}
+		for _, y := range x.Accounts() {
+			if only != nil && *only != y.Address {
+				return nil
+			}
+			address := y.Address
+			only = &address
+		}
+	}
+	if only != nil {
+		fmt.Fprintf(os.Stderr, "Using the only account, %s\n", only.Hex())
+		c.Set("from", only.Hex())
+	}
+	return nil
+}
+
+// onHardwareWallet reports whether unlockAccount will sign for from with a
+// hardware wallet, judging only by the key stores and --prefer so that no
+// device is asked: an account in no key store can only be on one.
+func onHardwareWallet(c *cli.Context, defaultKeyStores []string, from common.Address) bool {
+	switch c.String("prefer") {
+	case "keystore":
+		return false
+	case "ledger", "hardware":
+		return true
+	}
+	if c.String("from-uuid") != "" {
+		return false
+	}
+	for _, x := range getWallets(c, defaultKeyStores, false) {
+		for _, y := range x.Accounts() {
+			if y.Address == from {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// unlockAccount finds the account to sign with and, for keystore accounts,
+// reads its passphrase. Hardware accounts are confirmed on the device.
+func unlockAccount(c *cli.Context, wallets []accounts.Wallet, from common.Address) (accounts.Wallet, *accounts.Account, string, error) {
+	if prefer := c.String("prefer"); prefer != "" && prefer != "hardware" && prefer != "keystore" && prefer != "ledger" {
+		return nil, nil, "", fmt.Errorf("ethsign: --prefer must be hardware, keystore or ledger")
+	}
+
+	var wallet accounts.Wallet
+	var acct *accounts.Account
+	var derivationPath string
+	var err error
+	if c.String("from-uuid") != "" {
+		wallet, acct, err = findByUUID(wallets, c.String("from-uuid"))
+	} else {
+		wallet, acct, derivationPath, err = findAccount(wallets, from, c.String("prefer"))
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if c.Bool("require-device") && wallet.URL().Scheme == "keystore" {
+		return nil, nil, "", fmt.Errorf("ethsign: account is not on a hardware wallet (--require-device)")
+	}
+
+	if c.String("rate-limit") != "" {
+		limit, err := parseRateLimit(c.String("rate-limit"))
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("ethsign: invalid --rate-limit: %v", err)
+		}
+		state := c.String("rate-limit-state")
+		if state == "" {
+			state = defaultRateLimitState()
+		}
+		if err := checkRateLimit(state, limit, from); err != nil {
+			return nil, nil, "", err
+		}
+		wallet = &rateLimitedWallet{Wallet: wallet, state: state, limit: limit, account: from}
+	}
+
+	if wallet.URL().Scheme != "keystore" {
+		// findAccount derives without pinning, as list-accounts does, but
+		// the wallet only signs for pinned accounts, so derive the path
+		// again with pinning. If the two disagree, signing fails anyway.
+		path, _ := accounts.ParseDerivationPath(derivationPath)
+		pinned, err := wallet.Derive(path, true)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("ethsign: failed to derive %s again: %v", derivationPath, err)
+		}
+		if c.Bool("verify-derivation") {
+			if pinned.Address != acct.Address {
+				return nil, nil, "", fmt.Errorf("ethsign: %s derived as %s and as %s; refusing to sign", derivationPath, acct.Address.Hex(), pinned.Address.Hex())
+			}
+			fmt.Fprintf(os.Stderr, "Derivation of %s verified\n", derivationPath)
+		}
+		fmt.Fprintf(os.Stderr, "Signing with %s account at %s\n", wallet.URL().Scheme, derivationPath)
+		fmt.Fprintf(os.Stderr, "Waiting for hardware wallet confirmation...\n")
+		return wallet, acct, "", nil
+	}
+
+	passphrase, err := getPassphrase(c)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return wallet, acct, passphrase, nil
+}
+
+// accountFlags are the flags every signing command takes to choose the
+// signing account and unlock it.
+var accountFlags = []cli.Flag{
+	cli.StringSliceFlag{
+		Name:   "key-store",
+		Usage:  "path to key store",
+		EnvVar: "ETHSIGN_KEYSTORE,ETH_KEYSTORE",
+	},
+	cli.StringFlag{
+		Name:   "from",
+		Usage:  "address of signing account, or an alias for it in the config file",
+		EnvVar: "ETHSIGN_FROM,ETH_FROM",
+	},
+	cli.StringFlag{
+		Name:   "passphrase-file",
+		Usage:  "path to file containing account passphrase",
+		EnvVar: "ETHSIGN_PASSPHRASE_FILE",
+	},
+	cli.BoolFlag{
+		Name:  "passphrase-stdin",
+		Usage: "read account passphrase from the first line of stdin",
+	},
+	cli.StringFlag{
+		Name:  "passphrase-keychain",
+		Usage: "read account passphrase from the OS keychain entry SERVICE/ACCOUNT",
+	},
+	cli.StringFlag{
+		Name:  "from-uuid",
+		Usage: "select the signing keystore account by the id in its key file",
+	},
+	cli.BoolFlag{
+		Name:  "require-device",
+		Usage: "refuse to sign unless the account is on a hardware wallet",
+	},
+	cli.BoolFlag{
+		Name:  "verify-derivation",
+		Usage: "derive a hardware account's path a second time and refuse to sign if the addresses differ",
+	},
+	cli.StringFlag{
+		Name:   "rate-limit",
+		Usage:  "refuse to sign more than N times per account in a window, e.g. 10/1h",
+		EnvVar: "ETHSIGN_RATE_LIMIT",
+	},
+	cli.StringFlag{
+		Name:   "rate-limit-state",
+		Usage:  "file recording recent signatures for --rate-limit (default ~/.ethsign/rate-limit.json)",
+		EnvVar: "ETHSIGN_RATE_LIMIT_STATE",
+	},
+	cli.StringFlag{
+		Name:  "prefer",
+		Usage: "kind of wallet to sign with, required if the account is in several: keystore, ledger or hardware",
+	},
+}
+
 func main() {
 	var defaultKeyStores cli.StringSlice
 	if runtime.GOOS == "darwin" {
@@ -79,6 +617,37 @@ func main() {
 	app.Name = "ethsign"
 	app.Usage = "sign Ethereum transactions using a JSON keyfile"
 	app.Version = "0.10"
+	app.Flags = []cli.Flag{
+		cli.DurationFlag{
+			Name:  "rpc-timeout",
+			Usage: "timeout for each JSON-RPC call (0 for none)",
+			Value: 10 * time.Second,
+		},
+		cli.StringFlag{
+			Name:  "chain",
+			Usage: "network profile setting chain ID, RPC URL, currency symbol and explorer: mainnet, sepolia, holesky, optimism, arbitrum, base, polygon or gnosis",
+		},
+		cli.BoolFlag{
+			Name:  "capabilities",
+			Usage: "print a JSON description of what this build supports",
+		},
+		cli.StringFlag{
+			Name:   "config",
+			Usage:  "config file with fee presets (default ~/.ethsign/config.json)",
+			EnvVar: "ETHSIGN_CONFIG",
+		},
+	}
+	app.Action = func(c *cli.Context) error {
+		if c.Bool("capabilities") {
+			out, err := marshalJSON(capabilities(c.App), 0)
+			if err != nil {
+				return cli.NewExitError("ethsign: " + err.Error(), 1)
+			}
+			fmt.Println(string(out))
+			return nil
+		}
+		return cli.ShowAppHelp(c)
+	}
 	app.Commands = []cli.Command {
 		cli.Command {
 			Name: "list-accounts",
@@ -88,91 +657,309 @@ func main() {
 				cli.StringSliceFlag{
 					Name: "key-store",
 					Usage: "path to key store",
-					EnvVar: "ETH_KEYSTORE",
+					EnvVar: "ETHSIGN_KEYSTORE,ETH_KEYSTORE",
+				},
+				cli.BoolFlag{
+					Name: "env",
+					Usage: "print accounts as ETHSIGN_ACCOUNT_N=0x... lines",
+				},
+				cli.BoolFlag{
+					Name: "keystore-only",
+					Usage: "only list keystore accounts, skipping USB wallets",
+				},
+				cli.BoolFlag{
+					Name: "show-conflicts",
+					Usage: "mark addresses found in more than one kind of wallet",
+				},
+				cli.StringFlag{
+					Name: "hw-cache",
+					Usage: "file caching addresses derived from hardware wallets (default ~/.ethsign/hw-accounts.json)",
+				},
+				cli.BoolFlag{
+					Name: "refresh",
+					Usage: "derive hardware wallet addresses from the device again instead of using the cache, which is kept per USB port",
+				},
+				cli.BoolFlag{
+					Name: "fail-on-empty",
+					Usage: "exit with an error if no accounts are found",
+				},
+				cli.StringFlag{
+					Name: "xpub",
+					Usage: "list addresses derived from this extended public key instead of wallets (watch-only)",
+				},
+				cli.StringFlag{
+					Name: "xpub-path",
+					Usage: "path of the first address below --xpub",
+					Value: "0/0",
+				},
+				cli.IntFlag{
+					Name: "count",
+					Usage: "number of --xpub addresses to list",
+					Value: 5,
+				},
+				cli.BoolFlag{
+					Name: "list-paths",
+					Usage: "print the derivation paths that would be searched, without opening any wallet",
 				},
 			},
 			Action: func(c *cli.Context) error {
-				backends := []accounts.Backend{}
+				if c.Bool("list-paths") {
+					if c.String("xpub") == "" {
+						for _, pathstr := range ledgerPaths {
+							fmt.Printf("ledger %s\n", pathstr)
+						}
+						return nil
+					}
+					path, err := parseRelativePath(c.String("xpub-path"))
+					if err != nil {
+						return cli.NewExitError("ethsign: invalid --xpub-path: " + err.Error(), 1)
+					}
+					for i := 0; i < c.Int("count"); i++ {
+						var parts []string
+						for _, index := range path {
+							parts = append(parts, fmt.Sprint(index))
+						}
+						fmt.Printf("xpub %s\n", strings.Join(parts, "/"))
+						path[len(path)-1]++
+					}
+					return nil
+				}
 
-				var paths []string
-				if len(c.StringSlice("key-store")) == 0 {
-					paths = defaultKeyStores
-				} else {
-					paths = c.StringSlice("key-store")
+				type listedAccount struct {
+					address common.Address
+					scheme  string
+					source  string
 				}
-				for _, x := range(paths) {
-					ks := keystore.NewKeyStore(
-						x, keystore.StandardScryptN, keystore.StandardScryptP)
-					backends = append(backends, ks)
+				var listed []listedAccount
+				addAccount := func(address common.Address, source string) {
+					scheme := strings.SplitN(source, "-", 2)[0]
+					listed = append(listed, listedAccount{address, scheme, source})
 				}
 
-				if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
-					fmt.Fprintf(os.Stderr, "ethsign: failed to look for USB Ledgers")
-				} else {
-					backends = append(backends, ledgerhub)
+				cachePath := c.String("hw-cache")
+				if cachePath == "" {
+					cachePath = defaultHWCache()
 				}
-				if trezorhub, err := usbwallet.NewTrezorHub(); err != nil {
-					fmt.Fprintf(os.Stderr, "ethsign: failed to look for USB Trezors")
-				} else {
-					backends = append(backends, trezorhub)
+				cache, err := readHWCache(cachePath)
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to read --hw-cache: " + err.Error(), 1)
+				}
+				cacheChanged := false
+
+				if c.String("xpub") != "" {
+					xpub, err := parseXpub(c.String("xpub"))
+					if err != nil {
+						return cli.NewExitError("ethsign: invalid --xpub: " + err.Error(), 1)
+					}
+					path, err := parseRelativePath(c.String("xpub-path"))
+					if err != nil {
+						return cli.NewExitError("ethsign: invalid --xpub-path: " + err.Error(), 1)
+					}
+					for i := 0; i < c.Int("count"); i++ {
+						key := xpub
+						var parts []string
+						for _, index := range path {
+							if key, err = key.child(index); err != nil {
+								return cli.NewExitError("ethsign: " + err.Error(), 1)
+							}
+							parts = append(parts, fmt.Sprint(index))
+						}
+						addAccount(crypto.PubkeyToAddress(*key.key), "xpub-" + strings.Join(parts, "/"))
+						path[len(path)-1]++
+					}
 				}
 
-				manager := accounts.NewManager(backends...)
-				wallets := manager.Wallets()
+				var wallets []accounts.Wallet
+				if c.String("xpub") == "" {
+					wallets = getWallets(c, defaultKeyStores, !c.Bool("keystore-only"))
+				}
 				for _, x := range(wallets) {
 					if x.URL().Scheme == "keystore" {
 						for _, y := range(x.Accounts()) {
-							fmt.Printf("%s keystore\n", y.Address.Hex())
+							addAccount(y.Address, "keystore")
 						}
 					} else if x.URL().Scheme == "ledger" {
+						// The cache is keyed by the device's USB URL, so
+						// that a cached listing sends the device nothing and
+						// works while it is locked. The URL changes with
+						// the port, and another Ledger plugged into the same
+						// port is listed from the cache until --refresh.
+						deviceID := x.URL().String()
+
+						cached := cache[deviceID]
+						if cached != nil && !c.Bool("refresh") {
+							for _, pathstr := range ledgerPaths {
+								if address, ok := cached[pathstr]; ok {
+									addAccount(address, "ledger-" + pathstr)
+								}
+							}
+							continue
+						}
+
 						x.Open("")
-						for j := 0; j <= 3; j++ {
-							pathstr := fmt.Sprintf("m/44'/60'/0'/%d", j)
+						firstPath, _ := accounts.ParseDerivationPath(ledgerPaths[0])
+						first, err := x.Derive(firstPath, false)
+						if err != nil {
+							return cli.NewExitError(ledgerError(x, err), 1)
+						}
+						cached = map[string]common.Address{ledgerPaths[0]: first.Address}
+						addAccount(first.Address, "ledger-" + ledgerPaths[0])
+						for _, pathstr := range ledgerPaths[1:] {
 							path, _ := accounts.ParseDerivationPath(pathstr)
 							z, err := x.Derive(path, false)
 							if err != nil {
-								return cli.NewExitError("ethsign: couldn't use Ledger: needs to be in Ethereum app with browser support off", 1)
+								return cli.NewExitError(ledgerError(x, err), 1)
 							} else {
-								fmt.Printf("%s ledger-%s\n", z.Address.Hex(), pathstr)
+								addAccount(z.Address, "ledger-" + pathstr)
+								cached[pathstr] = z.Address
 							}
 						}
+						cache[deviceID] = cached
+						cacheChanged = true
 					}
 				}
-				
+
+				if cacheChanged {
+					if err := writeHWCache(cachePath, cache); err != nil {
+						fmt.Fprintf(os.Stderr, "ethsign: failed to write --hw-cache: %v\n", err)
+					}
+				}
+
+				schemes := make(map[common.Address]map[string]bool)
+				for _, x := range listed {
+					if schemes[x.address] == nil {
+						schemes[x.address] = make(map[string]bool)
+					}
+					schemes[x.address][x.scheme] = true
+				}
+
+				if len(listed) == 0 && c.Bool("fail-on-empty") {
+					return cli.NewExitError("ethsign: no accounts found", 1)
+				}
+
+				for i, x := range listed {
+					if c.Bool("env") {
+						fmt.Printf("ETHSIGN_ACCOUNT_%d=%s\n", i, x.address.Hex())
+					} else if c.Bool("show-conflicts") && len(schemes[x.address]) > 1 {
+						fmt.Printf("%s %s conflict\n", x.address.Hex(), x.source)
+					} else {
+						fmt.Printf("%s %s\n", x.address.Hex(), x.source)
+					}
+				}
+
 				return nil
 			},
 		},
 
-		cli.Command {
-			Name: "transaction",
-			Aliases: []string{"tx"},
-			Usage: "make a signed transaction",
+		cli.Command{
+			Name:  "print-address",
+			Usage: "print the address that would sign with the given account flags, without signing",
+			Flags: accountFlags,
+			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				if c.String("from") == "" {
+					return cli.NewExitError("ethsign: missing required parameter --from", 1)
+				}
+				if prefer := c.String("prefer"); prefer != "" && prefer != "hardware" && prefer != "keystore" && prefer != "ledger" {
+					return cli.NewExitError("ethsign: --prefer must be hardware, keystore or ledger", 1)
+				}
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				var wallet accounts.Wallet
+				var acct *accounts.Account
+				var path string
+				var err error
+				if c.String("from-uuid") != "" {
+					wallet, acct, err = findByUUID(wallets, c.String("from-uuid"))
+				} else {
+					wallet, acct, path, err = findAccount(wallets, common.HexToAddress(c.String("from")), c.String("prefer"))
+				}
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if wallet.URL().Scheme == "keystore" {
+					if c.Bool("require-device") {
+						return cli.NewExitError("ethsign: account is not on a hardware wallet (--require-device)", 1)
+					}
+					fmt.Fprintf(os.Stderr, "keystore %s\n", acct.URL.Path)
+				} else {
+					fmt.Fprintf(os.Stderr, "%s %s\n", wallet.URL().Scheme, path)
+				}
+				fmt.Println(acct.Address.Hex())
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "dump-state",
+			Usage: "print a JSON inventory of every wallet and account, without secrets",
 			Flags: []cli.Flag{
 				cli.StringSliceFlag{
-					Name: "key-store",
-					Usage: "path to key store",
-					EnvVar: "ETH_KEYSTORE",
+					Name:   "key-store",
+					Usage:  "path to key store",
+					EnvVar: "ETHSIGN_KEYSTORE,ETH_KEYSTORE",
 				},
 				cli.BoolFlag{
-					Name: "create",
-					Usage: "make a contract creation transaction",
+					Name:  "keystore-only",
+					Usage: "only include keystore accounts, skipping USB wallets",
 				},
-				cli.BoolFlag{
-					Name: "sig",
-					Usage: "create the signature only",
+				cli.IntFlag{
+					Name:  "json-indent",
+					Usage: "spaces per indentation level in JSON output (0 for a single line)",
 				},
-				cli.StringFlag{
-					Name: "from",
-					Usage: "address of signing account",
-					EnvVar: "ETH_FROM",
+			},
+			Action: func(c *cli.Context) error {
+				wallets := getWallets(c, defaultKeyStores, !c.Bool("keystore-only"))
+				dump, err := dumpState(wallets, time.Now())
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				out, err := marshalJSON(dump, c.Int("json-indent"))
+				if err != nil {
+					return cli.NewExitError("ethsign: " + err.Error(), 1)
+				}
+				fmt.Println(string(out))
+				return nil
+			},
+		},
+
+		cli.Command {
+			Name: "transaction",
+			Aliases: []string{"tx"},
+			Usage: "make a signed transaction",
+			Flags: append(accountFlags,
+				cli.BoolFlag{
+					Name: "create",
+					Usage: "make a contract creation transaction",
 				},
-				cli.StringFlag{
-					Name: "passphrase-file",
-					Usage: "path to file containing account passphrase",
+				cli.BoolFlag{
+					Name: "sig",
+					Usage: "create the signature only",
 				},
 				cli.StringFlag{
 					Name: "chain-id",
 					Usage: "chain ID",
+					EnvVar: "ETHSIGN_CHAIN_ID",
+				},
+				cli.BoolFlag{
+					Name: "allow-future-chain-id",
+					Usage: "sign for a chain ID that is not a known network",
+				},
+				cli.StringFlag{
+					Name: "template",
+					Usage: "JSON transaction template whose ${name} placeholders are filled from --var or ETHSIGN_VAR_NAME",
+				},
+				cli.StringSliceFlag{
+					Name: "var",
+					Usage: "NAME=VALUE to fill ${NAME} in --template",
+				},
+				cli.StringFlag{
+					Name: "network-file",
+					Usage: "EIP-3085 network JSON providing defaults for --chain-id and --rpc-url",
 				},
 				cli.StringFlag{
 					Name: "to",
@@ -180,15 +967,44 @@ func main() {
 				},
 				cli.StringFlag{
 					Name: "nonce",
-					Usage: "account nonce",
+					Usage: "account nonce, or +N for N past the pending nonce (needs --rpc-url)",
+				},
+				cli.StringFlag{
+					Name: "rpc-url",
+					Usage: "URL of the Ethereum JSON-RPC node",
+					EnvVar: "ETHSIGN_RPC_URL,ETH_RPC_URL",
 				},
 				cli.StringFlag{
 					Name: "gas-price",
-					Usage: "gas price",
+					Usage: "gas price of a legacy or type 1 transaction (default with --rpc-url: the node's suggestion)",
+				},
+				cli.StringFlag{
+					Name: "fee-preset",
+					Usage: "set --max-fee-per-gas, or --gas-price for legacy and type 1 transactions, from this named expression in the config file, evaluated against --rpc-url",
+				},
+				cli.StringFlag{
+					Name: "tx-type",
+					Usage: "transaction type: legacy, 1 (EIP-2930) or 2 (EIP-1559); without it and without fee flags, type 2 if --rpc-url's chain has a base fee, else legacy",
+				},
+				cli.StringFlag{
+					Name: "max-fee-per-gas, gas-fee-cap",
+					Usage: "most to pay per unit of gas in a type 2 transaction, go-ethereum's GasFeeCap (default with --rpc-url: twice the base fee plus the priority fee)",
+				},
+				cli.StringFlag{
+					Name: "max-priority-fee-per-gas, gas-tip-cap",
+					Usage: "most to tip the block producer per unit of gas in a type 2 transaction, go-ethereum's GasTipCap (default with --rpc-url: the node's suggestion)",
+				},
+				cli.StringFlag{
+					Name: "access-list",
+					Usage: "EIP-2930 access list, as JSON or the path of a JSON file, or auto to have --rpc-url's node create it; makes a legacy transaction type 1",
+				},
+				cli.StringFlag{
+					Name: "base-fee",
+					Usage: "base fee per gas at which to show what a type 2 transaction pays per gas (default with --rpc-url: the latest block's)",
 				},
 				cli.StringFlag{
 					Name: "gas-limit",
-					Usage: "gas limit",
+					Usage: "gas limit; signing is refused below the intrinsic gas of the transaction unless --force is given",
 				},
 				cli.StringFlag{
 					Name: "value",
@@ -198,10 +1014,195 @@ func main() {
 					Name: "data",
 					Usage: "hex data",
 				},
-			},
+				cli.StringFlag{
+					Name: "artifact",
+					Usage: "with --create, take the bytecode from this solc, Truffle or Foundry JSON artifact",
+				},
+				cli.StringFlag{
+					Name: "constructor-args",
+					Usage: "with --artifact, ABI-encoded constructor arguments as hex to append to the bytecode",
+				},
+				cli.StringFlag{
+					Name: "max-gas-cost",
+					Usage: "refuse to sign if gas limit times gas price exceeds this amount (e.g. 0.05ether)",
+				},
+				cli.BoolFlag{
+					Name: "verbose",
+					Usage: "print the canonical 0x-prefixed lower-case hex of the data being signed to stderr",
+				},
+				cli.BoolFlag{
+					Name: "verify-output",
+					Usage: "decode the signed transaction and check every field and the sender against the inputs",
+				},
+				cli.BoolFlag{
+					Name: "dry-run",
+					Usage: "print the transaction fields without signing, and with --rpc-url the total cost and the sender's balance",
+				},
+				cli.BoolFlag{
+					Name: "estimate-only",
+					Usage: "print the node's gas estimate and the projected cost, then exit without signing (needs --rpc-url)",
+				},
+				cli.BoolFlag{
+					Name: "min-balance",
+					Usage: "refuse to sign unless the balance covers value plus maximum gas cost (needs --rpc-url)",
+				},
+				cli.BoolFlag{
+					Name: "bump-gas-price",
+					Usage: "raise --gas-price, or --max-priority-fee-per-gas for a type 2 transaction, to the chain's minimum if it is below it",
+				},
+				cli.BoolFlag{
+					Name: "force",
+					Usage: "sign even if a safety check fails",
+				},
+				cli.StringFlag{
+					Name: "address-warnlist",
+					Usage: "file of addresses to warn about or refuse as --to",
+				},
+				cli.BoolFlag{
+					Name: "confirm-address",
+					Usage: "make the user retype the end of the --to address before signing",
+				},
+				cli.BoolFlag{
+					Name: "confirm-chain-id",
+					Usage: "make the user retype the chain ID before signing",
+				},
+				cli.BoolFlag{
+					Name: "yes",
+					Usage: "skip interactive confirmations",
+				},
+				cli.StringFlag{
+					Name: "out-raw",
+					Usage: "also write the signed transaction as hex to this file",
+				},
+				cli.StringFlag{
+					Name: "out-binary",
+					Usage: "also write the signed transaction as raw bytes (not hex) to this file",
+				},
+				cli.StringFlag{
+					Name: "out-cbor",
+					Usage: "also write the signed transaction, sender and chain ID as compact CBOR to this file, e.g. for a QR code",
+				},
+				cli.StringFlag{
+					Name: "out-json",
+					Usage: "also write the signed transaction as JSON to this file",
+				},
+				cli.StringFlag{
+					Name: "out-bridge-json",
+					Usage: "also write the signed transaction in a bridge/relayer JSON envelope to this file",
+				},
+				cli.StringFlag{
+					Name: "bridge-schema",
+					Usage: "JSON template for --out-bridge-json with {{raw}}, {{hash}}, {{from}}, {{to}}, {{nonce}}, {{chainId}} and {{submittedAt}} placeholders",
+				},
+				cli.StringFlag{
+					Name: "spool-dir",
+					Usage: "also write the signed transaction to this directory as <txhash>.hex (legacy transactions only; without --tx-type a legacy one is signed)",
+				},
+				cli.BoolFlag{
+					Name: "y-parity",
+					Usage: "in JSON output, give the signature's yParity (0 or 1) instead of v",
+				},
+				cli.IntFlag{
+					Name: "json-indent",
+					Usage: "spaces per indentation level in JSON output (0 for a single line)",
+				},
+				cli.StringFlag{
+					Name: "out-audit",
+					Usage: "append a line describing the signed transaction to this audit log",
+				},
+				cli.StringFlag{
+					Name: "memo",
+					Usage: "note recorded with the transaction in --out-audit and --out-json, never in the signed bytes",
+				},
+			),
 			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if c.String("template") != "" {
+					fields, err := readTemplate(c.String("template"), c.StringSlice("var"))
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to read --template: " + err.Error(), 1)
+					}
+					if err := applyTemplate(c, fields); err != nil {
+						return cli.NewExitError("ethsign: --template: " + err.Error(), 1)
+					}
+				}
+
+				// An RPC URL the user gave, rather than one from a network
+				// profile, is checked against the chain ID before signing.
+				explicitRPC := c.String("rpc-url") != ""
+
+				if c.GlobalString("chain") != "" && c.String("network-file") != "" {
+					return cli.NewExitError("ethsign: use only one of --chain and --network-file", 1)
+				}
+
+				symbol := "ether"
+				explorer := ""
+				var networkDef *network
+				if c.String("network-file") != "" {
+					net, err := readNetworkFile(c.String("network-file"))
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to read --network-file: " + err.Error(), 1)
+					}
+					networkDef = net
+					symbol = applyNetwork(c, net)
+					if len(net.BlockExplorerURLs) > 0 && net.ChainID != nil && c.String("chain-id") == net.ChainID.ToInt().String() {
+						explorer = net.BlockExplorerURLs[0]
+					}
+				}
+				if c.GlobalString("chain") != "" {
+					net, err := chainProfile(c.GlobalString("chain"))
+					if err != nil {
+						return cli.NewExitError(err, 1)
+					}
+					symbol = applyNetwork(c, net)
+					if c.String("chain-id") == net.ChainID.ToInt().String() {
+						explorer = net.BlockExplorerURLs[0]
+					}
+				}
+
+				// One connection serves every RPC call the command makes.
+				var node *rpcNode
+				if c.String("rpc-url") != "" {
+					var err error
+					if node, err = dialNode(c.String("rpc-url"), c.GlobalDuration("rpc-timeout")); err != nil {
+						return cli.NewExitError("ethsign: " + err.Error(), 1)
+					}
+					defer node.close()
+				}
+
+				if c.String("fee-preset") != "" {
+					if c.String("gas-price") != "" || c.String("max-fee-per-gas") != "" {
+						return cli.NewExitError("ethsign: use only one of --gas-price, --max-fee-per-gas and --fee-preset", 1)
+					}
+					if c.String("rpc-url") == "" {
+						return cli.NewExitError("ethsign: --fee-preset needs --rpc-url", 1)
+					}
+					conf, err := readConfig(c)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to read --config: " + err.Error(), 1)
+					}
+					gasPrice, err := feePreset(conf, c.String("fee-preset"), node)
+					if err != nil {
+						return cli.NewExitError("ethsign: " + err.Error(), 1)
+					}
+					switch c.String("tx-type") {
+					case "legacy", "0", "1":
+						fmt.Fprintf(os.Stderr, "Fee preset %s: gas price %s wei\n", c.String("fee-preset"), gasPrice)
+						c.Set("gas-price", gasPrice.String())
+					default:
+						fmt.Fprintf(os.Stderr, "Fee preset %s: max fee per gas %s wei\n", c.String("fee-preset"), gasPrice)
+						c.Set("max-fee-per-gas", gasPrice.String())
+					}
+				}
+
 				requireds := []string{
-					"nonce", "value", "gas-price", "gas-limit", "chain-id", "from",
+					"nonce", "value", "gas-limit", "chain-id", "from",
+				}
+				if c.Bool("estimate-only") {
+					requireds = []string{"from", "rpc-url"}
 				}
 
 				for _, required := range(requireds) {
@@ -216,122 +1217,2261 @@ func main() {
 					return cli.NewExitError("ethsign: need exactly one of --to or --create", 1)
 				}
 
-				if (create && c.String("data") == "") {
-					return cli.NewExitError("ethsign: need --data when doing --create", 1)
+				if c.String("artifact") != "" && !create {
+					return cli.NewExitError("ethsign: --artifact needs --create", 1)
+				}
+
+				if c.String("artifact") != "" && c.String("data") != "" {
+					return cli.NewExitError("ethsign: use only one of --artifact and --data", 1)
+				}
+
+				if c.String("constructor-args") != "" && c.String("artifact") == "" {
+					return cli.NewExitError("ethsign: --constructor-args needs --artifact", 1)
+				}
+
+				if (create && c.String("data") == "" && c.String("artifact") == "") {
+					return cli.NewExitError("ethsign: need --data or --artifact when doing --create", 1)
 				}
 
 				to := common.HexToAddress(c.String("to"))
 				from := common.HexToAddress(c.String("from"))
-				nonce := math.MustParseUint64(c.String("nonce"))
-				gasPrice := math.MustParseBig256(c.String("gas-price"))
+
+				data, err := parseHex(c.String("data"))
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --data: " + err.Error(), 1)
+				}
+
+				if c.String("artifact") != "" {
+					data, err = readArtifact(c.String("artifact"))
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to read --artifact: " + err.Error(), 1)
+					}
+					args, err := parseHex(c.String("constructor-args"))
+					if err != nil {
+						return cli.NewExitError("ethsign: invalid --constructor-args: " + err.Error(), 1)
+					}
+					if len(args) % 32 != 0 {
+						return cli.NewExitError("ethsign: --constructor-args must be a whole number of 32-byte words", 1)
+					}
+					data = append(data, args...)
+				}
+
+				if c.Bool("estimate-only") {
+					msg := ethereum.CallMsg{From: from, Data: data}
+					if !create {
+						msg.To = &to
+					}
+					if c.String("value") != "" {
+						msg.Value = math.MustParseBig256(c.String("value"))
+					}
+					gas, err := node.estimateGas(msg)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to estimate gas: " + err.Error(), 1)
+					}
+					var gasPrice *big.Int
+					if c.String("gas-price") != "" {
+						gasPrice = math.MustParseBig256(c.String("gas-price"))
+					} else if gasPrice, err = node.suggestGasPrice(); err != nil {
+						return cli.NewExitError("ethsign: failed to fetch gas price: " + err.Error(), 1)
+					}
+					cost := new(big.Int).Mul(new(big.Int).SetUint64(gas), gasPrice)
+					fmt.Printf("Gas estimate: %d\n", gas)
+					fmt.Printf("Gas price: %s wei\n", gasPrice)
+					fmt.Printf("Projected cost: %s %s\n", formatEther(cost), symbol)
+					return nil
+				}
+
+				feeCaps := c.String("max-fee-per-gas") != "" || c.String("max-priority-fee-per-gas") != ""
+				txType, err := chooseTxType(c.String("tx-type"), c.String("gas-price") != "", feeCaps, node)
+				if err != nil {
+					return cli.NewExitError("ethsign: " + err.Error(), 1)
+				}
+				if c.String("access-list") != "" && txType == 0 {
+					if c.String("tx-type") != "" {
+						return cli.NewExitError("ethsign: legacy transactions have no access list (use --tx-type 1 or 2)", 1)
+					}
+					txType = accessListTxType
+				}
+				// Hardware wallets and the spool only take legacy
+				// transactions. Unless a typed one was asked for, sign a
+				// legacy one for them rather than fail after the
+				// passphrase is typed or the device is touched.
+				legacyOnly := ""
+				if txType != 0 {
+					if c.String("spool-dir") != "" {
+						legacyOnly = "--spool-dir only takes legacy transactions"
+					} else if onHardwareWallet(c, defaultKeyStores, from) {
+						legacyOnly = "the account is not in a key store, and hardware wallets can only sign legacy transactions"
+					}
+				}
+				if legacyOnly != "" {
+					if c.String("tx-type") != "" || feeCaps || c.String("access-list") != "" {
+						return cli.NewExitError("ethsign: " + legacyOnly + " (use --tx-type legacy, with --gas-price and without --access-list)", 1)
+					}
+					fmt.Fprintf(os.Stderr, "Signing a legacy transaction: %s\n", legacyOnly)
+					txType = 0
+				} else if c.String("tx-type") == "" && c.String("gas-price") == "" && !feeCaps && node != nil {
+					switch txType {
+					case dynamicFeeTxType:
+						fmt.Fprintln(os.Stderr, "The chain has a base fee: signing an EIP-1559 (type 2) transaction")
+					case accessListTxType:
+						fmt.Fprintln(os.Stderr, "The chain has no base fee: signing an EIP-2930 (type 1) transaction for the access list")
+					default:
+						fmt.Fprintln(os.Stderr, "The chain has no base fee: signing a legacy transaction")
+					}
+				}
+
+				if txType == dynamicFeeTxType {
+					if c.String("max-fee-per-gas") == "" || c.String("max-priority-fee-per-gas") == "" {
+						if node == nil {
+							return cli.NewExitError("ethsign: missing required parameter --max-fee-per-gas or --max-priority-fee-per-gas (or give --rpc-url)", 1)
+						}
+						tip, maxFee, err := defaultFees(node)
+						if err != nil {
+							return cli.NewExitError("ethsign: " + err.Error(), 1)
+						}
+						if c.String("max-priority-fee-per-gas") == "" {
+							c.Set("max-priority-fee-per-gas", tip.String())
+						}
+						if c.String("max-fee-per-gas") == "" {
+							c.Set("max-fee-per-gas", maxFee.String())
+						}
+					}
+				} else if c.String("gas-price") == "" {
+					if node == nil {
+						return cli.NewExitError("ethsign: missing required parameter --gas-price", 1)
+					}
+					suggested, err := node.suggestGasPrice()
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to fetch gas price: " + err.Error(), 1)
+					}
+					c.Set("gas-price", suggested.String())
+				}
+
+				var nonce uint64
+				if strings.HasPrefix(c.String("nonce"), "+") {
+					offset, ok := math.ParseUint64(c.String("nonce")[1:])
+					if !ok {
+						return cli.NewExitError("ethsign: invalid --nonce offset", 1)
+					}
+					if c.String("rpc-url") == "" {
+						return cli.NewExitError("ethsign: --nonce +N needs --rpc-url", 1)
+					}
+					pending, err := node.pendingNonce(from)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to fetch pending nonce: " + err.Error(), 1)
+					}
+					nonce = pending + offset
+				} else {
+					nonce = math.MustParseUint64(c.String("nonce"))
+				}
+
+				// For a type 2 transaction gasPrice is the max fee per
+				// gas, the most it can cost, which the checks below use.
+				var gasPrice, gasTipCap *big.Int
+				if txType == dynamicFeeTxType {
+					gasPrice = math.MustParseBig256(c.String("max-fee-per-gas"))
+					gasTipCap = math.MustParseBig256(c.String("max-priority-fee-per-gas"))
+					if gasTipCap.Cmp(gasPrice) > 0 {
+						return cli.NewExitError("ethsign: --max-priority-fee-per-gas is above --max-fee-per-gas", 1)
+					}
+				} else {
+					gasPrice = math.MustParseBig256(c.String("gas-price"))
+				}
 				gasLimit := math.MustParseUint64(c.String("gas-limit"))
 				value := math.MustParseBig256(c.String("value"))
 				chainID := math.MustParseBig256(c.String("chain-id"))
+
+				if err := checkChainID(chainID, c.Bool("allow-future-chain-id")); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if explicitRPC {
+					if err := checkNodeChainID(node, chainID); err != nil {
+						return cli.NewExitError(err, 1)
+					}
+				}
 				
-				dataString := c.String("data")
-				if dataString == "" {
-					dataString = "0x"
+				// The chain's minimum applies to what validators are paid:
+				// the gas price, or the priority fee of a type 2
+				// transaction, whose max fee is raised with it if needed.
+				if floor := minGasPrice(chainID, networkDef); floor != nil {
+					price, flag := gasPrice, "--gas-price"
+					if txType == dynamicFeeTxType {
+						price, flag = gasTipCap, "--max-priority-fee-per-gas"
+					}
+					if price.Cmp(floor) < 0 {
+						if c.Bool("bump-gas-price") {
+							fmt.Fprintf(os.Stderr, "Raising %s from %s to the minimum of %s wei on %s\n", flag, price, floor, chainName(chainID))
+							if txType == dynamicFeeTxType {
+								gasTipCap = new(big.Int).Set(floor)
+								if gasPrice.Cmp(floor) < 0 {
+									fmt.Fprintf(os.Stderr, "Raising --max-fee-per-gas from %s to %s wei to cover it\n", gasPrice, floor)
+									gasPrice = new(big.Int).Set(floor)
+								}
+							} else {
+								gasPrice = new(big.Int).Set(floor)
+							}
+						} else {
+							fmt.Fprintf(os.Stderr, "Warning: %s %s is below the minimum of %s wei on %s\n", flag, price, floor, chainName(chainID))
+							if !c.Bool("force") {
+								return cli.NewExitError("ethsign: " + flag + " is below the chain's minimum (use --bump-gas-price to raise it, or --force to sign anyway)", 1)
+							}
+						}
+					}
+				}
+
+				if c.Bool("verbose") {
+					fmt.Fprintf(os.Stderr, "Data: %s\n", hexutil.Encode(data))
+				}
+
+				if create && len(data) == 0 {
+					fmt.Fprintf(os.Stderr, "Warning: creating a contract with empty bytecode, which deploys nothing\n")
+					if !c.Bool("force") {
+						return cli.NewExitError("ethsign: --create with empty bytecode (use --force to sign anyway)", 1)
+					}
+				}
+
+				var accesses accessList
+				if c.String("access-list") == "auto" {
+					if node == nil {
+						return cli.NewExitError("ethsign: --access-list auto needs --rpc-url", 1)
+					}
+					msg := ethereum.CallMsg{From: from, Value: value, Data: data}
+					if !create {
+						msg.To = &to
+					}
+					without, err := node.estimateGas(msg)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to estimate gas: " + err.Error(), 1)
+					}
+					msg.Gas = gasLimit
+					var with uint64
+					if accesses, with, err = node.createAccessList(msg); err != nil {
+						return cli.NewExitError("ethsign: failed to create access list: " + err.Error(), 1)
+					}
+					out, _ := marshalJSON(accesses, 2)
+					fmt.Fprintf(os.Stderr, "Access list: %s\n", out)
+					if with <= without {
+						fmt.Fprintf(os.Stderr, "The access list saves %d gas (%d with it, %d without)\n", without-with, with, without)
+					} else {
+						fmt.Fprintf(os.Stderr, "Warning: the access list costs %d more gas (%d with it, %d without)\n", with-without, with, without)
+					}
+				} else if c.String("access-list") != "" {
+					if accesses, err = readAccessList(c.String("access-list")); err != nil {
+						return cli.NewExitError("ethsign: invalid --access-list: " + err.Error(), 1)
+					}
+				}
+
+				intrinsic := intrinsicGas(data, create) + accessListGas(accesses)
+				if gasLimit < intrinsic && !c.Bool("force") {
+					return cli.NewExitError(fmt.Sprintf("ethsign: --gas-limit %d is below the intrinsic gas of %d (use --force to sign anyway)", gasLimit, intrinsic), 1)
+				}
+
+				if c.String("max-gas-cost") != "" {
+					maxGasCost, err := parseAmount(c.String("max-gas-cost"))
+					if err != nil {
+						return cli.NewExitError("ethsign: invalid --max-gas-cost: " + err.Error(), 1)
+					}
+					gasCost := new(big.Int).Mul(new(big.Int).SetUint64(gasLimit), gasPrice)
+					fmt.Fprintf(os.Stderr, "Max gas cost: %s %s\n", formatEther(gasCost), symbol)
+					if gasCost.Cmp(maxGasCost) > 0 && !c.Bool("force") {
+						return cli.NewExitError("ethsign: max gas cost exceeds --max-gas-cost of " + formatEther(maxGasCost) + " " + symbol + " (use --force to sign anyway)", 1)
+					}
 				}
-				data := hexutil.MustDecode(dataString)
 				
-				backends := []accounts.Backend{ }
+				if c.Bool("min-balance") {
+					if c.String("rpc-url") == "" {
+						return cli.NewExitError("ethsign: --min-balance needs --rpc-url", 1)
+					}
+					balance, err := node.balance(from)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to fetch balance: " + err.Error(), 1)
+					}
+					needed := new(big.Int).Mul(new(big.Int).SetUint64(gasLimit), gasPrice)
+					needed.Add(needed, value)
+					if balance.Cmp(needed) < 0 {
+						shortfall := new(big.Int).Sub(needed, balance)
+						fmt.Fprintf(os.Stderr, "Balance: %s %s, needed: %s %s, short by %s %s\n",
+							formatEther(balance), symbol, formatEther(needed), symbol, formatEther(shortfall), symbol)
+						if !c.Bool("force") {
+							return cli.NewExitError("ethsign: balance does not cover value plus maximum gas cost (use --force to sign anyway)", 1)
+						}
+					}
+				}
 
-				var paths []string
-				if len(c.StringSlice("key-store")) == 0 {
-					paths = defaultKeyStores
+				if c.String("address-warnlist") != "" && !create {
+					warnlist, err := readWarnlist(c.String("address-warnlist"))
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to read --address-warnlist: " + err.Error(), 1)
+					}
+					if entry, ok := warnlist[to]; ok {
+						if entry.note != "" {
+							fmt.Fprintf(os.Stderr, "Warning: --to %s is on the address warnlist (%s)\n", to.Hex(), entry.note)
+						} else {
+							fmt.Fprintf(os.Stderr, "Warning: --to %s is on the address warnlist\n", to.Hex())
+						}
+						if entry.block && !c.Bool("force") {
+							return cli.NewExitError("ethsign: --to is blocked by the address warnlist (use --force to sign anyway)", 1)
+						}
+					}
+				}
+
+				// A typed transaction is described through a legacy one
+				// with the same fields, priced at its max fee per gas.
+				var tx *types.Transaction
+				if create {
+					tx = types.NewContractCreation(nonce, value, gasLimit, gasPrice, data)
 				} else {
-					paths = c.StringSlice("key-store")
+					tx = types.NewTransaction(nonce, to, value, gasLimit, gasPrice, data)
 				}
-				for _, x := range(paths) {
-					ks := keystore.NewKeyStore(
-						x, keystore.StandardScryptN, keystore.StandardScryptP)
-					backends = append(backends, ks)
+				var ttx *typedTx
+				if txType != 0 {
+					ttx = &typedTx{Type: byte(txType), ChainID: chainID, Nonce: nonce, Gas: gasLimit, Value: value, Data: data, AccessList: accesses}
+					if !create {
+						ttx.To = &to
+					}
+					if txType == dynamicFeeTxType {
+						ttx.GasTipCap, ttx.GasFeeCap = gasTipCap, gasPrice
+					} else {
+						ttx.GasPrice = gasPrice
+					}
 				}
 
-				if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
-					fmt.Fprintf(os.Stderr, "ethsign: failed to look for USB Ledgers")
-				} else {
-					backends = append(backends, ledgerhub)
+				// What a type 2 transaction pays per gas depends on the
+				// base fee of the block it lands in.
+				var baseFee, effectiveGasPrice *big.Int
+				if txType == dynamicFeeTxType {
+					if c.String("base-fee") != "" {
+						baseFee = math.MustParseBig256(c.String("base-fee"))
+					} else if node != nil {
+						if baseFee, err = node.baseFee(); err != nil {
+							return cli.NewExitError("ethsign: failed to fetch base fee: " + err.Error(), 1)
+						}
+					}
 				}
-				if trezorhub, err := usbwallet.NewTrezorHub(); err != nil {
-					fmt.Fprintf(os.Stderr, "ethsign: failed to look for USB Trezors")
-				} else {
-					backends = append(backends, trezorhub)
+				if baseFee != nil {
+					effectiveGasPrice = ttx.effectiveGasPrice(baseFee)
+					if baseFee.Cmp(ttx.GasFeeCap) > 0 {
+						fmt.Fprintf(os.Stderr, "Warning: the max fee per gas is below the base fee of %s wei; the transaction waits until the base fee falls\n", baseFee)
+					}
 				}
 
-				manager := accounts.NewManager(backends...)
-				wallets := manager.Wallets()
-				var wallet accounts.Wallet
-				var acct *accounts.Account
+				if c.Bool("dry-run") {
+					fmt.Print(describeFields(tx, ttx, from, chainID, symbol))
+					if effectiveGasPrice != nil {
+						fmt.Printf("Effective gas price: %s wei at a base fee of %s wei\n", effectiveGasPrice, baseFee)
+					}
+					if c.String("rpc-url") == "" {
+						return nil
+					}
+					balance, err := node.balance(from)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to fetch balance: " + err.Error(), 1)
+					}
+					total := new(big.Int).Mul(new(big.Int).SetUint64(gasLimit), gasPrice)
+					total.Add(total, value)
+					fmt.Printf("Total cost: %s %s (value plus gas limit times gas price)\n", formatEther(total), symbol)
+					fmt.Printf("Balance: %s %s\n", formatEther(balance), symbol)
+					if balance.Cmp(total) < 0 {
+						fmt.Printf("Insufficient balance: short by %s %s\n", formatEther(new(big.Int).Sub(total, balance)), symbol)
+						return cli.NewExitError("ethsign: balance does not cover the total cost", 1)
+					}
+					return nil
+				}
 
-				needPassphrase := true
+				if c.Bool("confirm-address") && !create && !c.Bool("yes") {
+					if err := confirmAddress(to); err != nil {
+						return cli.NewExitError(err, 1)
+					}
+				}
 
-				Scan:
-				for _, x := range(wallets) {
-					if x.URL().Scheme == "keystore" {
-						for _, y := range(x.Accounts()) {
-							if (y.Address == from) {
-								wallet = x
-								acct = &y
-								break Scan
-							}
-						}
-					} else if x.URL().Scheme == "ledger" {
-						x.Open("")
-						for j := 0; j <= 3; j++ {
-							pathstr := fmt.Sprintf("m/44'/60'/0'/%d", j)
-							path, _ := accounts.ParseDerivationPath(pathstr)
-							y, err := x.Derive(path, true)
-							if err != nil {
-								return cli.NewExitError("ethsign: Ledger needs to be in Ethereum app with browser support off", 1)
-							} else {
-								if y.Address == from {
-									wallet = x
-									acct = &y
-									needPassphrase = false
-									break Scan
-								}
-							}
-						}
+				if c.Bool("confirm-chain-id") && !c.Bool("yes") {
+					if err := confirmChainID(chainID); err != nil {
+						return cli.NewExitError(err, 1)
+					}
+				}
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				wallet, acct, passphrase, err := unlockAccount(c, wallets, from)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if ttx != nil && wallet.URL().Scheme != "keystore" {
+					return cli.NewExitError("ethsign: hardware wallets can only sign legacy transactions (use --tx-type legacy)", 1)
+				}
+
+				summary := describeTx(tx, from, chainID, symbol)
+				if effectiveGasPrice != nil {
+					cost := new(big.Int).Mul(effectiveGasPrice, new(big.Int).SetUint64(gasLimit))
+					summary += fmt.Sprintf(" At a base fee of %s wei it pays %s wei per gas, up to %s %s.", baseFee, effectiveGasPrice, formatEther(cost), symbol)
+				}
+				fmt.Fprintf(os.Stderr, "%s\n", summary)
+
+				var signed *types.Transaction
+				var signedTyped *typedTx
+				var encoded []byte
+				var txHash common.Hash
+				if ttx != nil {
+					signedTyped, encoded, err = signTypedTx(wallet, *acct, passphrase, ttx)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to sign tx", 1)
+					}
+					txHash = signedTyped.hash()
+				} else {
+					signed, encoded, err = signLegacyTx(wallet, *acct, passphrase, tx, chainID)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to sign tx", 1)
+					}
+					txHash = signed.Hash()
+				}
+				fmt.Fprintf(os.Stderr, "Size: %d bytes, intrinsic gas: %d\n", len(encoded), intrinsic)
+
+				if c.Bool("verify-output") {
+					var mismatches []string
+					var err error
+					if ttx != nil {
+						mismatches, err = verifyTypedTx(encoded, ttx, from)
+					} else {
+						mismatches, err = verifyEncodedTx(encoded, tx, from, chainID)
+					}
+					if err != nil {
+						return cli.NewExitError("ethsign: --verify-output: failed to decode signed tx: " + err.Error(), 1)
+					}
+					for _, m := range mismatches {
+						fmt.Fprintf(os.Stderr, "ethsign: --verify-output: %s\n", m)
+					}
+					if len(mismatches) > 0 {
+						return cli.NewExitError("ethsign: signed transaction does not match the inputs", 1)
+					}
+				}
+
+				if explorer != "" {
+					fmt.Fprintf(os.Stderr, "Explorer: %s/tx/%s\n", strings.TrimRight(explorer, "/"), txHash.Hex())
+				}
+
+				signature := c.Bool("sig")
+				if(signature){
+					var v, r, s *big.Int
+					if signedTyped != nil {
+						v, r, s = signedTyped.V, signedTyped.R, signedTyped.S
+					} else {
+						v, r, s = signed.RawSignatureValues()
+					}
+					fmt.Println(fmt.Sprintf("0x%064x%064x%02x", r, s, v))
+				}else{
+					fmt.Println(hexutil.Encode(encoded[:]))
+				}
+
+				if c.String("out-raw") != "" {
+					err := writeBinary(c.String("out-raw"), []byte(hexutil.Encode(encoded) + "\n"))
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to write --out-raw file", 1)
+					}
+				}
+
+				if c.String("out-binary") != "" {
+					if err := writeBinary(c.String("out-binary"), encoded); err != nil {
+						return cli.NewExitError("ethsign: failed to write --out-binary file", 1)
+					}
+				}
+
+				if c.String("out-cbor") != "" {
+					if !chainID.IsUint64() {
+						return cli.NewExitError("ethsign: --out-cbor needs a chain ID that fits in 64 bits", 1)
+					}
+					out := encodeCBORTx(cborTx{encoded, from, chainID.Uint64()})
+					if err := ioutil.WriteFile(c.String("out-cbor"), out, 0600); err != nil {
+						return cli.NewExitError("ethsign: failed to write --out-cbor file", 1)
+					}
+				}
+
+				if c.String("spool-dir") != "" {
+					path, err := writeSpool(c.String("spool-dir"), signed)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to write to --spool-dir", 1)
+					}
+					fmt.Fprintf(os.Stderr, "Spooled transaction to %s\n", path)
+				}
+
+				if c.String("out-json") != "" || c.String("out-audit") != "" || c.String("out-bridge-json") != "" {
+					var output *signedTx
+					if signedTyped != nil {
+						output, err = newSignedTypedTx(signedTyped, from)
+					} else {
+						output, err = newSignedTx(signed, from, chainID)
+					}
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to encode tx", 1)
+					}
+					output.Summary = summary
+					output.EffectiveGasPrice = (*hexutil.Big)(effectiveGasPrice)
+					output.Memo = c.String("memo")
+					if c.Bool("y-parity") {
+						output.useYParity()
+					}
+					if c.String("out-json") != "" {
+						if err := writeJSON(c.String("out-json"), output, c.Int("json-indent")); err != nil {
+							return cli.NewExitError("ethsign: failed to write --out-json file", 1)
+						}
+					}
+					if c.String("out-bridge-json") != "" {
+						envelope, err := bridgeEnvelope(output, c.String("bridge-schema"), time.Now())
+						if err != nil {
+							return cli.NewExitError("ethsign: failed to read --bridge-schema: " + err.Error(), 1)
+						}
+						if err := writeJSON(c.String("out-bridge-json"), envelope, c.Int("json-indent")); err != nil {
+							return cli.NewExitError("ethsign: failed to write --out-bridge-json file", 1)
+						}
+					}
+					if c.String("out-audit") != "" {
+						if err := appendAuditLog(c.String("out-audit"), output); err != nil {
+							return cli.NewExitError("ethsign: failed to write --out-audit log", 1)
+						}
+					}
+				}
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:    "message",
+			Aliases: []string{"msg"},
+			Usage:   "sign arbitrary data with header prefix",
+			Flags: append(accountFlags,
+				cli.StringFlag{
+					Name:  "data",
+					Usage: "data to sign, interpreted according to --encoding",
+				},
+				cli.StringFlag{
+					Name:  "encoding",
+					Usage: "encoding of --data: hex, text or base64",
+					Value: "hex",
+				},
+				cli.BoolFlag{
+					Name:  "strict-hex",
+					Usage: "require hex --data to be exactly 0x and an even number of digits, without surrounding whitespace",
+				},
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "signature format: rsv (65 bytes), compact (EIP-2098, 64 bytes) or rs (64 bytes, without v)",
+					Value: "rsv",
+				},
+				cli.StringFlag{
+					Name:  "v-encoding",
+					Usage: "encoding of V in rsv signatures: 27 (27/28) or 0 (0/1)",
+					Value: "27",
+				},
+				cli.StringFlag{
+					Name:  "validator",
+					Usage: "sign as EIP-191 version 0x00 data for this intended validator contract, instead of as a personal message",
+				},
+				cli.BoolFlag{
+					Name:  "verbose",
+					Usage: "print the decoded --data as canonical 0x-prefixed lower-case hex to stderr",
+				},
+				cli.BoolFlag{
+					Name:  "print-preimage",
+					Usage: "print the prefixed bytes that are hashed and signed to stderr",
+				},
+				cli.BoolFlag{
+					Name:  "with-nonce",
+					Usage: "append \"\\nNonce: <random hex>\\nIssued At: <RFC 3339 time>\" to the data and print it in --encoding before the signature, which stays on the last line",
+				},
+				cli.BoolFlag{
+					Name:   "self-check",
+					Usage:  "sign twice and check that both signatures are identical",
+					Hidden: true,
+				},
+			),
+			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				requireds := []string{
+					"from", "data",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				format := c.String("format")
+				if format != "rsv" && format != "compact" && format != "rs" {
+					return cli.NewExitError("ethsign: --format must be rsv, compact or rs", 1)
+				}
+
+				if c.String("v-encoding") != "27" && c.String("v-encoding") != "0" {
+					return cli.NewExitError("ethsign: --v-encoding must be 27 or 0", 1)
+				}
+
+				from := common.HexToAddress(c.String("from"))
+
+				var data []byte
+				var err error
+				if c.Bool("strict-hex") && c.String("encoding") == "hex" {
+					data, err = parseStrictHex(c.String("data"))
+				} else {
+					data, err = decodeData(c.String("data"), c.String("encoding"))
+				}
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --data: "+err.Error(), 1)
+				}
+
+				if c.Bool("with-nonce") {
+					nonce := make([]byte, 16)
+					if _, err := rand.Read(nonce); err != nil {
+						return cli.NewExitError("ethsign: failed to generate nonce", 1)
+					}
+					data = appendNonce(data, nonce, time.Now())
+				}
+
+				if c.Bool("verbose") {
+					fmt.Fprintf(os.Stderr, "Data: %s\n", hexutil.Encode(data))
+				}
+
+				preimage := signPreimage(data)
+				if c.String("validator") != "" {
+					preimage = validatorPreimage(common.HexToAddress(c.String("validator")), data)
+				}
+				hash := crypto.Keccak256(preimage)
+
+				if c.Bool("print-preimage") {
+					fmt.Fprintf(os.Stderr, "Preimage: %s\n", hexutil.Encode(preimage))
+				}
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				wallet, acct, passphrase, err := unlockAccount(c, wallets, from)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				signature, err := wallet.SignHashWithPassphrase(*acct, passphrase, hash)
+
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to sign message", 1)
+				}
+
+				if c.Bool("self-check") {
+					again, err := wallet.SignHashWithPassphrase(*acct, passphrase, hash)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to sign message for self-check", 1)
+					}
+					if !bytes.Equal(signature, again) {
+						return cli.NewExitError("ethsign: self-check failed: signing twice gave different signatures", 1)
+					}
+					fmt.Fprintf(os.Stderr, "Self-check passed: signature is deterministic\n")
+				}
+
+				if format == "compact" {
+					signature = compactSignature(signature)
+				} else if format == "rs" {
+					signature = signature[:64]
+				} else if c.String("v-encoding") == "27" {
+					signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+				}
+
+				if c.Bool("with-nonce") {
+					fmt.Println(encodeData(data, c.String("encoding")))
+				}
+				fmt.Println(hexutil.Encode(signature))
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "sign-file",
+			Usage: "sign the hash of a file's contents",
+			Flags: append(accountFlags,
+				cli.StringFlag{
+					Name:  "file",
+					Usage: "path to file to sign",
+				},
+				cli.StringFlag{
+					Name:  "hash",
+					Usage: "hash function: keccak256 or sha256",
+					Value: "keccak256",
+				},
+				cli.BoolFlag{
+					Name:  "prefix",
+					Usage: "sign the hash as a message with the Ethereum header prefix",
+				},
+			),
+			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				requireds := []string{
+					"from", "file",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				from := common.HexToAddress(c.String("from"))
+
+				contents, err := ioutil.ReadFile(c.String("file"))
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to read --file", 1)
+				}
+
+				var fileHash []byte
+				switch c.String("hash") {
+				case "keccak256":
+					fileHash = crypto.Keccak256(contents)
+				case "sha256":
+					sum := sha256.Sum256(contents)
+					fileHash = sum[:]
+				default:
+					return cli.NewExitError("ethsign: --hash must be keccak256 or sha256", 1)
+				}
+
+				hash := fileHash
+				if c.Bool("prefix") {
+					hash = signHash(fileHash)
+				}
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				wallet, acct, passphrase, err := unlockAccount(c, wallets, from)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				signature, err := wallet.SignHashWithPassphrase(*acct, passphrase, hash)
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to sign file hash", 1)
+				}
+
+				signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+
+				fmt.Println(hexutil.Encode(fileHash))
+				fmt.Println(hexutil.Encode(signature))
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "sign-packed",
+			Usage: "sign keccak256(abi.encodePacked(...)) of typed values",
+			Flags: append(accountFlags,
+				cli.StringFlag{
+					Name:  "types",
+					Usage: "comma-separated Solidity types, e.g. address,uint256,string",
+				},
+				cli.StringFlag{
+					Name:  "values",
+					Usage: "comma-separated values, one per type; double-quote a value to keep spaces or commas in it",
+				},
+				cli.BoolFlag{
+					Name:  "prefix",
+					Usage: "sign the hash as a message with the Ethereum header prefix",
+				},
+			),
+			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				requireds := []string{
+					"from", "types",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				from := common.HexToAddress(c.String("from"))
+
+				types := strings.Split(c.String("types"), ",")
+				for i := range types {
+					types[i] = strings.TrimSpace(types[i])
+				}
+				values, err := splitValues(c.String("values"))
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --values: "+err.Error(), 1)
+				}
+
+				packed, err := encodePacked(types, values)
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to pack --values: "+err.Error(), 1)
+				}
+
+				packedHash := crypto.Keccak256(packed)
+				hash := packedHash
+				if c.Bool("prefix") {
+					hash = signHash(packedHash)
+				}
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				wallet, acct, passphrase, err := unlockAccount(c, wallets, from)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				signature, err := wallet.SignHashWithPassphrase(*acct, passphrase, hash)
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to sign packed hash", 1)
+				}
+
+				signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
+
+				fmt.Println(hexutil.Encode(packedHash))
+				fmt.Println(hexutil.Encode(signature))
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "permit",
+			Usage: "sign an EIP-2612 token permit",
+			Flags: append(accountFlags,
+				cli.StringFlag{
+					Name:  "token",
+					Usage: "address of the token contract",
+				},
+				cli.StringFlag{
+					Name:  "name",
+					Usage: "token's EIP-712 domain name",
+				},
+				cli.StringFlag{
+					Name:  "version",
+					Usage: "token's EIP-712 domain version",
+					Value: "1",
+				},
+				cli.StringFlag{
+					Name:   "chain-id",
+					Usage:  "chain ID",
+					EnvVar: "ETHSIGN_CHAIN_ID",
+				},
+				cli.BoolFlag{
+					Name:  "allow-future-chain-id",
+					Usage: "sign for a chain ID that is not a known network",
+				},
+				cli.StringFlag{
+					Name:  "spender",
+					Usage: "address allowed to spend the tokens",
+				},
+				cli.StringFlag{
+					Name:  "value",
+					Usage: "amount of tokens allowed",
+				},
+				cli.StringFlag{
+					Name:  "nonce",
+					Usage: "owner's permit nonce on the token",
+				},
+				cli.StringFlag{
+					Name:  "deadline",
+					Usage: "timestamp after which the permit expires",
+				},
+				cli.BoolFlag{
+					Name:  "verbose",
+					Usage: "print the domain separator, struct hash and digest to stderr",
+				},
+			),
+			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if c.GlobalString("chain") != "" {
+					net, err := chainProfile(c.GlobalString("chain"))
+					if err != nil {
+						return cli.NewExitError(err, 1)
+					}
+					applyNetwork(c, net)
+				}
+
+				requireds := []string{
+					"from", "token", "name", "chain-id", "spender", "value", "nonce", "deadline",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				from := common.HexToAddress(c.String("from"))
+				token := common.HexToAddress(c.String("token"))
+				spender := common.HexToAddress(c.String("spender"))
+				chainID := math.MustParseBig256(c.String("chain-id"))
+				value := math.MustParseBig256(c.String("value"))
+				nonce := math.MustParseBig256(c.String("nonce"))
+				deadline := math.MustParseBig256(c.String("deadline"))
+
+				if err := checkChainID(chainID, c.Bool("allow-future-chain-id")); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				separator := domainSeparator(c.String("name"), c.String("version"), chainID, token)
+				structHash := hashStruct(
+					"Permit(address owner,address spender,uint256 value,uint256 nonce,uint256 deadline)",
+					from, spender, value, nonce, deadline,
+				)
+				hash := typedDataHash(separator, structHash)
+
+				if c.Bool("verbose") {
+					printTypedDataHashes(separator, structHash, hash)
+				}
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				wallet, acct, passphrase, err := unlockAccount(c, wallets, from)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				var signature []byte
+				if wallet.URL().Scheme == "ledger" {
+					members := map[string]interface{}{
+						"owner":    from.Hex(),
+						"spender":  spender.Hex(),
+						"value":    value.String(),
+						"nonce":    nonce.String(),
+						"deadline": deadline.String(),
+					}
+					domain := newLedgerDomain(c.String("name"), c.String("version"), chainID, token)
+					if signature, err = signTypedDataOnLedger(wallet, from, permitSchema, members, domain, separator, structHash); err != nil {
+						return cli.NewExitError(err, 1)
+					}
+				} else if signature, err = wallet.SignHashWithPassphrase(*acct, passphrase, hash); err != nil {
+					return cli.NewExitError("ethsign: failed to sign permit", 1)
+				}
+
+				fmt.Println(signature[64] + 27)
+				fmt.Println(hexutil.Encode(signature[:32]))
+				fmt.Println(hexutil.Encode(signature[32:64]))
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "permit2",
+			Usage: "sign a Uniswap Permit2 transfer or allowance permit",
+			Flags: append(accountFlags,
+				cli.StringFlag{
+					Name:  "type",
+					Usage: "permit to sign: transfer (PermitTransferFrom), batch-transfer (PermitBatchTransferFrom), single (PermitSingle) or batch (PermitBatch)",
+					Value: "transfer",
+				},
+				cli.StringFlag{
+					Name:  "permit2",
+					Usage: "address of the Permit2 contract",
+					Value: permit2Address,
+				},
+				cli.StringFlag{
+					Name:   "chain-id",
+					Usage:  "chain ID",
+					EnvVar: "ETHSIGN_CHAIN_ID",
+				},
+				cli.BoolFlag{
+					Name:  "allow-future-chain-id",
+					Usage: "sign for a chain ID that is not a known network",
+				},
+				cli.StringSliceFlag{
+					Name:  "token",
+					Usage: "address of a token contract (repeat for batches)",
+				},
+				cli.StringSliceFlag{
+					Name:  "amount",
+					Usage: "amount of each --token, in the same order",
+				},
+				cli.StringSliceFlag{
+					Name:  "expiration",
+					Usage: "for single and batch, timestamp at which each allowance expires, in --token order",
+				},
+				cli.StringSliceFlag{
+					Name:  "nonce",
+					Usage: "permit nonce for transfer types, or each token's allowance nonce for single and batch",
+				},
+				cli.StringFlag{
+					Name:  "spender",
+					Usage: "address allowed to spend the tokens",
+				},
+				cli.StringFlag{
+					Name:  "deadline",
+					Usage: "timestamp after which the signature expires",
+				},
+				cli.BoolFlag{
+					Name:  "verbose",
+					Usage: "print the domain separator, struct hash and digest to stderr",
+				},
+			),
+			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if c.GlobalString("chain") != "" {
+					net, err := chainProfile(c.GlobalString("chain"))
+					if err != nil {
+						return cli.NewExitError(err, 1)
+					}
+					applyNetwork(c, net)
+				}
+
+				requireds := []string{
+					"from", "chain-id", "spender", "deadline",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				typ := c.String("type")
+				allowance := typ == "single" || typ == "batch"
+				tokenAddrs := c.StringSlice("token")
+				amounts := c.StringSlice("amount")
+				expirations := c.StringSlice("expiration")
+				nonces := c.StringSlice("nonce")
+
+				if len(amounts) != len(tokenAddrs) {
+					return cli.NewExitError("ethsign: need one --amount per --token", 1)
+				}
+				if allowance && (len(expirations) != len(tokenAddrs) || len(nonces) != len(tokenAddrs)) {
+					return cli.NewExitError("ethsign: need one --expiration and one --nonce per --token", 1)
+				}
+				if !allowance && len(expirations) > 0 {
+					return cli.NewExitError("ethsign: --expiration is only used with --type single or batch", 1)
+				}
+				if !allowance && len(nonces) != 1 {
+					return cli.NewExitError("ethsign: need exactly one --nonce", 1)
+				}
+
+				parse := func(name string, s string) (*big.Int, error) {
+					n, ok := math.ParseBig256(s)
+					if !ok {
+						return nil, fmt.Errorf("ethsign: invalid --%s %q", name, s)
+					}
+					return n, nil
+				}
+
+				var tokens []permit2Token
+				for i, addr := range tokenAddrs {
+					t := permit2Token{token: common.HexToAddress(addr)}
+					var err error
+					if t.amount, err = parse("amount", amounts[i]); err != nil {
+						return cli.NewExitError(err, 1)
+					}
+					if allowance {
+						if t.expiration, err = parse("expiration", expirations[i]); err != nil {
+							return cli.NewExitError(err, 1)
+						}
+						if t.nonce, err = parse("nonce", nonces[i]); err != nil {
+							return cli.NewExitError(err, 1)
+						}
+					}
+					tokens = append(tokens, t)
+				}
+
+				var nonce *big.Int
+				if !allowance {
+					var err error
+					if nonce, err = parse("nonce", nonces[0]); err != nil {
+						return cli.NewExitError(err, 1)
+					}
+				}
+
+				from := common.HexToAddress(c.String("from"))
+				spender := common.HexToAddress(c.String("spender"))
+				chainID := math.MustParseBig256(c.String("chain-id"))
+				deadline, err := parse("deadline", c.String("deadline"))
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if err := checkChainID(chainID, c.Bool("allow-future-chain-id")); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				separator := permit2DomainSeparator(chainID, common.HexToAddress(c.String("permit2")))
+				structHash, err := permit2StructHash(typ, tokens, spender, nonce, deadline)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				hash := typedDataHash(separator, structHash)
+
+				if c.Bool("verbose") {
+					printTypedDataHashes(separator, structHash, hash)
+				}
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				wallet, acct, passphrase, err := unlockAccount(c, wallets, from)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				var signature []byte
+				if wallet.URL().Scheme == "ledger" {
+					sch, members := permit2Message(typ, tokens, spender, nonce, deadline)
+					domain := permit2LedgerDomain(chainID, common.HexToAddress(c.String("permit2")))
+					if signature, err = signTypedDataOnLedger(wallet, from, sch, members, domain, separator, structHash); err != nil {
+						return cli.NewExitError(err, 1)
+					}
+				} else if signature, err = wallet.SignHashWithPassphrase(*acct, passphrase, hash); err != nil {
+					return cli.NewExitError("ethsign: failed to sign permit", 1)
+				}
+
+				signature[64] += 27
+				fmt.Println(hexutil.Encode(signature))
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "user-op",
+			Usage: "build and sign an ERC-4337 UserOperation, printing it as JSON for a bundler",
+			Flags: append(accountFlags,
+				cli.StringFlag{
+					Name:  "sender",
+					Usage: "address of the smart account",
+				},
+				cli.StringFlag{
+					Name:  "nonce",
+					Usage: "smart account's EntryPoint nonce",
+				},
+				cli.StringFlag{
+					Name:  "init-code",
+					Usage: "hex factory address and calldata deploying the account, if not yet deployed",
+				},
+				cli.StringFlag{
+					Name:  "call-data",
+					Usage: "hex calldata the account executes",
+				},
+				cli.StringFlag{
+					Name:  "call-gas-limit",
+					Usage: "gas limit of the execution call",
+				},
+				cli.StringFlag{
+					Name:  "verification-gas-limit",
+					Usage: "gas limit of the verification step",
+				},
+				cli.StringFlag{
+					Name:  "pre-verification-gas",
+					Usage: "gas paid to the bundler for overhead",
+				},
+				cli.StringFlag{
+					Name:  "max-fee-per-gas",
+					Usage: "maximum fee per gas (e.g. 30gwei)",
+				},
+				cli.StringFlag{
+					Name:  "max-priority-fee-per-gas",
+					Usage: "maximum priority fee per gas (e.g. 1gwei)",
+				},
+				cli.StringFlag{
+					Name:  "paymaster-and-data",
+					Usage: "hex paymaster address and data, if sponsored",
+				},
+				cli.StringFlag{
+					Name:  "entry-point",
+					Usage: "address of the EntryPoint contract",
+					Value: entryPointAddress,
+				},
+				cli.StringFlag{
+					Name:   "chain-id",
+					Usage:  "chain ID",
+					EnvVar: "ETHSIGN_CHAIN_ID",
+				},
+				cli.BoolFlag{
+					Name:  "allow-future-chain-id",
+					Usage: "sign for a chain ID that is not a known network",
+				},
+				cli.BoolFlag{
+					Name:  "raw-hash",
+					Usage: "sign the userOpHash itself instead of its EIP-191 message hash, for accounts that expect that",
+				},
+				cli.IntFlag{
+					Name:  "json-indent",
+					Usage: "spaces per indentation level in JSON output (0 for a single line)",
+				},
+			),
+			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if c.GlobalString("chain") != "" {
+					net, err := chainProfile(c.GlobalString("chain"))
+					if err != nil {
+						return cli.NewExitError(err, 1)
+					}
+					applyNetwork(c, net)
+				}
+
+				requireds := []string{
+					"from", "sender", "nonce", "call-gas-limit", "verification-gas-limit",
+					"pre-verification-gas", "max-fee-per-gas", "max-priority-fee-per-gas", "chain-id",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				op := &userOperation{Sender: common.HexToAddress(c.String("sender"))}
+				for _, f := range []struct {
+					name string
+					dst  **hexutil.Big
+					fee  bool
+				}{
+					{"nonce", &op.Nonce, false},
+					{"call-gas-limit", &op.CallGasLimit, false},
+					{"verification-gas-limit", &op.VerificationGasLimit, false},
+					{"pre-verification-gas", &op.PreVerificationGas, false},
+					{"max-fee-per-gas", &op.MaxFeePerGas, true},
+					{"max-priority-fee-per-gas", &op.MaxPriorityFeePerGas, true},
+				} {
+					var n *big.Int
+					if f.fee {
+						var err error
+						if n, err = parseAmount(c.String(f.name)); err != nil {
+							return cli.NewExitError("ethsign: invalid --"+f.name+": "+err.Error(), 1)
+						}
+					} else {
+						var ok bool
+						if n, ok = math.ParseBig256(c.String(f.name)); !ok {
+							return cli.NewExitError("ethsign: invalid --"+f.name, 1)
+						}
+					}
+					*f.dst = (*hexutil.Big)(n)
+				}
+				for _, f := range []struct {
+					name string
+					dst  *hexutil.Bytes
+				}{
+					{"init-code", &op.InitCode},
+					{"call-data", &op.CallData},
+					{"paymaster-and-data", &op.PaymasterAndData},
+				} {
+					b, err := parseHex(c.String(f.name))
+					if err != nil {
+						return cli.NewExitError("ethsign: invalid --"+f.name+": "+err.Error(), 1)
+					}
+					*f.dst = b
+				}
+
+				from := common.HexToAddress(c.String("from"))
+				chainID := math.MustParseBig256(c.String("chain-id"))
+
+				if err := checkChainID(chainID, c.Bool("allow-future-chain-id")); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				userOpHash := op.hash(common.HexToAddress(c.String("entry-point")), chainID)
+				fmt.Fprintf(os.Stderr, "UserOp hash: %s\n", hexutil.Encode(userOpHash))
+
+				hash := signHash(userOpHash)
+				if c.Bool("raw-hash") {
+					hash = userOpHash
+				}
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				wallet, acct, passphrase, err := unlockAccount(c, wallets, from)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				signature, err := wallet.SignHashWithPassphrase(*acct, passphrase, hash)
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to sign user operation", 1)
+				}
+				signature[64] += 27
+				op.Signature = signature
+
+				out, err := marshalJSON(op, c.Int("json-indent"))
+				if err != nil {
+					return cli.NewExitError("ethsign: "+err.Error(), 1)
+				}
+				fmt.Println(string(out))
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "safe-tx",
+			Usage: "sign a Safe multisig transaction and print the Safe Transaction Service proposal JSON",
+			Flags: append(accountFlags,
+				cli.StringFlag{
+					Name:  "safe",
+					Usage: "address of the Safe",
+				},
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "address the Safe calls",
+				},
+				cli.StringFlag{
+					Name:  "value",
+					Usage: "amount of ether the Safe sends, in wei",
+					Value: "0",
+				},
+				cli.StringFlag{
+					Name:  "data",
+					Usage: "hex calldata of the Safe's call",
+				},
+				cli.StringFlag{
+					Name:  "operation",
+					Usage: "0 for a call, 1 for a delegatecall",
+					Value: "0",
+				},
+				cli.StringFlag{
+					Name:  "safe-tx-gas",
+					Usage: "gas for the Safe's call, or 0 for all available",
+					Value: "0",
+				},
+				cli.StringFlag{
+					Name:  "base-gas",
+					Usage: "gas costs independent of the call, for refunds",
+					Value: "0",
+				},
+				cli.StringFlag{
+					Name:  "gas-price",
+					Usage: "gas price used for the refund, or 0 for no refund",
+					Value: "0",
+				},
+				cli.StringFlag{
+					Name:  "gas-token",
+					Usage: "token the refund is paid in, or the zero address for ether",
+					Value: "0x0000000000000000000000000000000000000000",
+				},
+				cli.StringFlag{
+					Name:  "refund-receiver",
+					Usage: "address receiving the refund, or the zero address for tx.origin",
+					Value: "0x0000000000000000000000000000000000000000",
+				},
+				cli.StringFlag{
+					Name:  "nonce",
+					Usage: "Safe nonce",
+				},
+				cli.StringFlag{
+					Name:   "chain-id",
+					Usage:  "chain ID",
+					EnvVar: "ETHSIGN_CHAIN_ID",
+				},
+				cli.BoolFlag{
+					Name:  "allow-future-chain-id",
+					Usage: "sign for a chain ID that is not a known network",
+				},
+				cli.IntFlag{
+					Name:  "json-indent",
+					Usage: "spaces per indentation level in JSON output (0 for a single line)",
+				},
+			),
+			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if c.GlobalString("chain") != "" {
+					net, err := chainProfile(c.GlobalString("chain"))
+					if err != nil {
+						return cli.NewExitError(err, 1)
+					}
+					applyNetwork(c, net)
+				}
+
+				requireds := []string{
+					"from", "safe", "to", "nonce", "chain-id",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				if c.String("operation") != "0" && c.String("operation") != "1" {
+					return cli.NewExitError("ethsign: --operation must be 0 (call) or 1 (delegatecall)", 1)
+				}
+
+				tx := &safeTx{
+					Safe:           checksumAddress(common.HexToAddress(c.String("safe"))),
+					To:             checksumAddress(common.HexToAddress(c.String("to"))),
+					GasToken:       checksumAddress(common.HexToAddress(c.String("gas-token"))),
+					RefundReceiver: checksumAddress(common.HexToAddress(c.String("refund-receiver"))),
+					Sender:         checksumAddress(common.HexToAddress(c.String("from"))),
+				}
+				if c.String("operation") == "1" {
+					tx.Operation = 1
+					fmt.Fprintf(os.Stderr, "Warning: the Safe will delegatecall %s, which can change any of its state\n", common.HexToAddress(c.String("to")).Hex())
+				}
+				for _, f := range []struct {
+					name string
+					dst  **big.Int
+				}{
+					{"value", &tx.Value},
+					{"safe-tx-gas", &tx.SafeTxGas},
+					{"base-gas", &tx.BaseGas},
+					{"gas-price", &tx.GasPrice},
+					{"nonce", &tx.Nonce},
+				} {
+					n, ok := math.ParseBig256(c.String(f.name))
+					if !ok {
+						return cli.NewExitError("ethsign: invalid --"+f.name, 1)
+					}
+					*f.dst = n
+				}
+
+				data, err := parseHex(c.String("data"))
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --data: "+err.Error(), 1)
+				}
+				if len(data) > 0 {
+					tx.Data = (*hexutil.Bytes)(&data)
+				}
+
+				chainID := math.MustParseBig256(c.String("chain-id"))
+				if err := checkChainID(chainID, c.Bool("allow-future-chain-id")); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				hash := tx.hash(chainID)
+				tx.ContractTransactionHash = common.BytesToHash(hash)
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				wallet, acct, passphrase, err := unlockAccount(c, wallets, common.Address(tx.Sender))
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				signature, err := wallet.SignHashWithPassphrase(*acct, passphrase, hash)
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to sign Safe transaction", 1)
+				}
+				signature[64] += 27
+				tx.Signature = signature
+
+				out, err := marshalJSON(tx, c.Int("json-indent"))
+				if err != nil {
+					return cli.NewExitError("ethsign: "+err.Error(), 1)
+				}
+				fmt.Println(string(out))
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "sign-schema",
+			Usage: "sign EIP-712 typed data built from a schema file and --field values",
+			Flags: append(accountFlags,
+				cli.StringFlag{
+					Name:  "schema",
+					Usage: "schema file: each struct's name, then one \"name type\" member per line; the first struct is signed",
+				},
+				cli.StringSliceFlag{
+					Name:  "field",
+					Usage: "member value as name=value, in JSON for struct and array members (repeat for each member)",
+				},
+				cli.StringFlag{
+					Name:  "domain-name",
+					Usage: "EIP-712 domain name",
+				},
+				cli.StringFlag{
+					Name:  "domain-version",
+					Usage: "EIP-712 domain version",
+					Value: "1",
+				},
+				cli.StringFlag{
+					Name:   "chain-id",
+					Usage:  "chain ID",
+					EnvVar: "ETHSIGN_CHAIN_ID",
+				},
+				cli.BoolFlag{
+					Name:  "allow-future-chain-id",
+					Usage: "sign for a chain ID that is not a known network",
+				},
+				cli.StringFlag{
+					Name:  "verifying-contract",
+					Usage: "EIP-712 domain verifying contract",
+				},
+				cli.BoolFlag{
+					Name:  "verbose",
+					Usage: "print the domain separator, struct hash and digest to stderr",
+				},
+			),
+			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if c.GlobalString("chain") != "" {
+					net, err := chainProfile(c.GlobalString("chain"))
+					if err != nil {
+						return cli.NewExitError(err, 1)
+					}
+					applyNetwork(c, net)
+				}
+
+				requireds := []string{
+					"from", "schema", "domain-name", "chain-id", "verifying-contract",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				sch, err := readSchema(c.String("schema"))
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to read --schema: "+err.Error(), 1)
+				}
+
+				values := make(map[string]string)
+				for _, field := range c.StringSlice("field") {
+					parts := strings.SplitN(field, "=", 2)
+					if len(parts) != 2 {
+						return cli.NewExitError("ethsign: --field must be name=value", 1)
+					}
+					values[parts[0]] = parts[1]
+				}
+
+				structHash, err := sch.hash(values)
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --field: "+err.Error(), 1)
+				}
+
+				from := common.HexToAddress(c.String("from"))
+				chainID := math.MustParseBig256(c.String("chain-id"))
+				verifyingContract := common.HexToAddress(c.String("verifying-contract"))
+
+				if err := checkChainID(chainID, c.Bool("allow-future-chain-id")); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				separator := domainSeparator(c.String("domain-name"), c.String("domain-version"), chainID, verifyingContract)
+				hash := typedDataHash(separator, structHash)
+
+				if c.Bool("verbose") {
+					printTypedDataHashes(separator, structHash, hash)
+				}
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				wallet, acct, passphrase, err := unlockAccount(c, wallets, from)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				var signature []byte
+				if wallet.URL().Scheme == "ledger" {
+					members, err := sch.members(values)
+					if err != nil {
+						return cli.NewExitError("ethsign: invalid --field: "+err.Error(), 1)
+					}
+					domain := newLedgerDomain(c.String("domain-name"), c.String("domain-version"), chainID, verifyingContract)
+					if signature, err = signTypedDataOnLedger(wallet, from, sch, members, domain, separator, structHash); err != nil {
+						return cli.NewExitError(err, 1)
+					}
+				} else if signature, err = wallet.SignHashWithPassphrase(*acct, passphrase, hash); err != nil {
+					return cli.NewExitError("ethsign: failed to sign typed data", 1)
+				}
+				signature[64] += 27
+
+				fmt.Println(hexutil.Encode(signature))
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "siwe",
+			Usage: "make and sign an EIP-4361 Sign-In with Ethereum message",
+			Flags: append(accountFlags,
+				cli.StringFlag{
+					Name:  "domain",
+					Usage: "domain requesting the sign-in, e.g. example.com",
+				},
+				cli.StringFlag{
+					Name:  "statement",
+					Usage: "human-readable statement the user agrees to",
+				},
+				cli.StringFlag{
+					Name:  "uri",
+					Usage: "URI of the resource being signed in to",
+				},
+				cli.StringFlag{
+					Name:  "version",
+					Usage: "message version",
+					Value: "1",
+				},
+				cli.StringFlag{
+					Name:   "chain-id",
+					Usage:  "chain ID",
+					EnvVar: "ETHSIGN_CHAIN_ID",
+				},
+				cli.StringFlag{
+					Name:  "nonce",
+					Usage: "nonce from the server, at least 8 alphanumeric characters (random if not given)",
+				},
+				cli.StringFlag{
+					Name:  "issued-at",
+					Usage: "RFC 3339 issue time (default now)",
+				},
+				cli.StringFlag{
+					Name:  "expiration-time",
+					Usage: "RFC 3339 time after which the message is invalid",
+				},
+				cli.StringFlag{
+					Name:  "not-before",
+					Usage: "RFC 3339 time before which the message is invalid",
+				},
+				cli.StringFlag{
+					Name:  "request-id",
+					Usage: "request identifier",
+				},
+				cli.StringSliceFlag{
+					Name:  "resource",
+					Usage: "URI of a resource to include (repeatable)",
+				},
+			),
+			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if c.GlobalString("chain") != "" {
+					net, err := chainProfile(c.GlobalString("chain"))
+					if err != nil {
+						return cli.NewExitError(err, 1)
+					}
+					applyNetwork(c, net)
+				}
+
+				requireds := []string{
+					"from", "domain", "uri", "chain-id",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				chainID, ok := math.ParseBig256(c.String("chain-id"))
+				if !ok {
+					return cli.NewExitError("ethsign: invalid --chain-id", 1)
+				}
+
+				nonce := c.String("nonce")
+				if nonce == "" {
+					random := make([]byte, 8)
+					if _, err := rand.Read(random); err != nil {
+						return cli.NewExitError("ethsign: failed to generate nonce", 1)
+					}
+					nonce = fmt.Sprintf("%x", random)
+				}
+				if err := checkSiweNonce(nonce); err != nil {
+					return cli.NewExitError("ethsign: invalid --nonce: "+err.Error(), 1)
+				}
+
+				issuedAt := c.String("issued-at")
+				if issuedAt == "" {
+					issuedAt = time.Now().UTC().Format(time.RFC3339)
+				}
+				for _, name := range []string{"issued-at", "expiration-time", "not-before"} {
+					if c.String(name) == "" {
+						continue
+					}
+					if _, err := time.Parse(time.RFC3339, c.String(name)); err != nil {
+						return cli.NewExitError("ethsign: --"+name+" must be an RFC 3339 time", 1)
+					}
+				}
+
+				if strings.Contains(c.String("statement"), "\n") {
+					return cli.NewExitError("ethsign: --statement cannot contain newlines", 1)
+				}
+
+				from := common.HexToAddress(c.String("from"))
+				message := &siweMessage{
+					Domain:         c.String("domain"),
+					Address:        from,
+					Statement:      c.String("statement"),
+					URI:            c.String("uri"),
+					Version:        c.String("version"),
+					ChainID:        chainID,
+					Nonce:          nonce,
+					IssuedAt:       issuedAt,
+					ExpirationTime: c.String("expiration-time"),
+					NotBefore:      c.String("not-before"),
+					RequestID:      c.String("request-id"),
+					Resources:      c.StringSlice("resource"),
+				}
+				text := message.String()
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				wallet, acct, passphrase, err := unlockAccount(c, wallets, from)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				signature, err := wallet.SignHashWithPassphrase(*acct, passphrase, signHash([]byte(text)))
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to sign message", 1)
+				}
+				signature[64] += 27
+
+				// The message is printed without a trailing newline of its
+				// own; the signature is always the last line.
+				fmt.Println(text)
+				fmt.Println(hexutil.Encode(signature))
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "siwe-verify",
+			Usage: "verify a signed Sign-In with Ethereum message",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "message-file",
+					Usage: "file containing the exact message text",
+				},
+				cli.StringFlag{
+					Name:  "sig",
+					Usage: "signature",
+				},
+				cli.StringFlag{
+					Name:  "domain",
+					Usage: "expected domain",
+				},
+				cli.StringFlag{
+					Name:  "chain-id",
+					Usage: "expected chain ID",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				requireds := []string{
+					"message-file", "sig",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				contents, err := ioutil.ReadFile(c.String("message-file"))
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to read --message-file", 1)
+				}
+				text := strings.TrimSuffix(string(contents), "\n")
+
+				message, err := parseSiweMessage(text)
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid message: "+err.Error(), 1)
+				}
+
+				sig, err := parseHex(c.String("sig"))
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --sig: "+err.Error(), 1)
+				}
+
+				recoveredAddr, err := recover([]byte(text), sig)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				if recoveredAddr != message.Address {
+					return cli.NewExitError("ethsign: address did not match. Wanted "+message.Address.String()+" got "+recoveredAddr.String(), 1)
+				}
+
+				if c.String("domain") != "" && c.String("domain") != message.Domain {
+					return cli.NewExitError("ethsign: domain did not match. Wanted "+c.String("domain")+" got "+message.Domain, 1)
+				}
+				if c.String("chain-id") != "" && (message.ChainID == nil || c.String("chain-id") != message.ChainID.String()) {
+					return cli.NewExitError("ethsign: chain ID did not match. Wanted "+c.String("chain-id"), 1)
+				}
+				if err := checkSiweTimes(message, time.Now()); err != nil {
+					return cli.NewExitError("ethsign: "+err.Error(), 1)
+				}
+
+				fmt.Println(message.Address.Hex())
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:    "verify",
+			Usage:   "verify signed data by given key",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:   "from",
+					Usage:  "address to verify",
+				},
+				cli.StringFlag{
+					Name:  "data",
+					Usage: "hex data to verify",
+				},
+				cli.StringFlag{
+					Name:  "sig",
+					Usage: "signature",
+				},
+				cli.StringFlag{
+					Name:   "rpc-url",
+					Usage:  "URL of the Ethereum JSON-RPC node, to verify the signature of a contract account with its isValidSignature (EIP-1271)",
+					EnvVar: "ETHSIGN_RPC_URL,ETH_RPC_URL",
+				},
+				cli.BoolFlag{
+					Name:  "eip6492",
+					Usage: "accept a signature wrapped for a contract account that is not deployed yet, simulating its deployment (EIP-6492; needs --rpc-url)",
+				},
+				cli.BoolFlag{
+					Name:  "recursive",
+					Usage: "also check the signatures of contract owners packed in a contract account's signature, as a Safe owned by Safes takes them, and print every signer (needs --rpc-url)",
+				},
+				cli.IntFlag{
+					Name:  "max-depth",
+					Usage: "how many levels of contract owners --recursive follows",
+					Value: 4,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				requireds := []string{
+					"from", "data", "sig",
+				}
+				if c.Bool("eip6492") || c.Bool("recursive") {
+					requireds = append(requireds, "rpc-url")
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				from := common.HexToAddress(c.String("from"))
+
+				data, err := parseHex(c.String("data"))
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --data: "+err.Error(), 1)
+				}
+
+				sig, err := parseHex(c.String("sig"))
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --sig: "+err.Error(), 1)
+				}
+
+				if c.String("rpc-url") == "" && bytes.HasSuffix(sig, eip6492Suffix) {
+					return cli.NewExitError("ethsign: the signature is for a contract that is not deployed yet (EIP-6492); verify it with --eip6492 and --rpc-url", 1)
+				}
+
+				if c.String("rpc-url") != "" {
+					node, err := dialNode(c.String("rpc-url"), c.GlobalDuration("rpc-timeout"))
+					if err != nil {
+						return cli.NewExitError("ethsign: "+err.Error(), 1)
+					}
+					defer node.close()
+					var verified bool
+					if c.Bool("recursive") {
+						verified, err = verifyRecursive(node, from, signHash(data), sig, c.Bool("eip6492"), c.Int("max-depth"), os.Stdout)
+					} else {
+						verified, err = verifyContractSignature(node, from, signHash(data), sig, c.Bool("eip6492"))
+					}
+					if err != nil {
+						return cli.NewExitError(err, 1)
+					}
+					if verified {
+						return nil
+					}
+				}
+
+				recoveredAddr, err := recover(data, sig)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if from != recoveredAddr {
+					return cli.NewExitError("ethsign: address did not match. Wanted "+from.String()+" got "+recoveredAddr.String(), 1)
+				}
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "verify-batch",
+			Usage: "verify many signatures listed in a JSON file",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "file",
+					Usage: "JSON array of {\"data\", \"signature\", \"address\"} entries, with hex data",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.String("file") == "" {
+					return cli.NewExitError("ethsign: missing required parameter --file", 1)
+				}
+
+				contents, err := ioutil.ReadFile(c.String("file"))
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to read --file", 1)
+				}
+
+				var entries []struct {
+					Data      string `json:"data"`
+					Signature string `json:"signature"`
+					Address   string `json:"address"`
+				}
+				if err := json.Unmarshal(contents, &entries); err != nil {
+					return cli.NewExitError("ethsign: invalid --file: "+err.Error(), 1)
+				}
+
+				failed := 0
+				for i, entry := range entries {
+					from := common.HexToAddress(entry.Address)
+
+					var recoveredAddr common.Address
+					data, err := parseHex(entry.Data)
+					if err == nil {
+						var sig []byte
+						if sig, err = parseHex(entry.Signature); err == nil {
+							recoveredAddr, err = recover(data, sig)
+						}
+					}
+
+					switch {
+					case err != nil:
+						fmt.Printf("%d %s invalid: %v\n", i, from.Hex(), err)
+						failed++
+					case recoveredAddr != from:
+						fmt.Printf("%d %s invalid: signed by %s\n", i, from.Hex(), recoveredAddr.Hex())
+						failed++
+					default:
+						fmt.Printf("%d %s valid\n", i, from.Hex())
+					}
+				}
+
+				if failed > 0 {
+					return cli.NewExitError(fmt.Sprintf("ethsign: %d of %d signatures are invalid", failed, len(entries)), 1)
+				}
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:    "recover",
+			Usage:   "recover ethereum address from signature",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "data",
+					Usage: "hex data to verify",
+				},
+				cli.StringFlag{
+					Name:  "sig",
+					Usage: "signature",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				requireds := []string{
+					"data", "sig",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+					}
+				}
+
+				data, err := parseHex(c.String("data"))
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --data: "+err.Error(), 1)
+				}
+
+				sig, err := parseHex(c.String("sig"))
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --sig: "+err.Error(), 1)
+				}
+
+				recoveredAddr, err := recover(data, sig)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				fmt.Println(recoveredAddr.String())
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "hash",
+			Usage: "hash data with Keccak-256 or NIST SHA3-256",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "data",
+					Usage: "data to hash",
+				},
+				cli.StringFlag{
+					Name:  "encoding",
+					Usage: "encoding of --data: hex, text or base64",
+					Value: "hex",
+				},
+				cli.StringFlag{
+					Name:  "algo",
+					Usage: "keccak256 (what Ethereum uses) or sha3-256 (NIST SHA3, a different hash)",
+					Value: "keccak256",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.String("data") == "" {
+					return cli.NewExitError("ethsign: missing required parameter --data", 1)
+				}
+
+				data, err := decodeData(c.String("data"), c.String("encoding"))
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				switch c.String("algo") {
+				case "keccak256":
+					fmt.Println(hexutil.Encode(crypto.Keccak256(data)))
+				case "sha3-256":
+					sum := sha3.Sum256(data)
+					fmt.Println(hexutil.Encode(sum[:]))
+				default:
+					return cli.NewExitError("ethsign: --algo must be keccak256 or sha3-256", 1)
+				}
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "check-tx",
+			Usage: "check that a raw signed transaction matches the expected fields",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "raw",
+					Usage: "raw signed transaction as hex",
+				},
+				cli.StringFlag{
+					Name:  "cbor",
+					Usage: "file written by transaction --out-cbor, instead of --raw",
+				},
+				cli.StringFlag{
+					Name:  "expect-from",
+					Usage: "expected signer address",
+				},
+				cli.StringFlag{
+					Name:  "expect-to",
+					Usage: "expected recipient address, or \"create\" for a contract creation",
+				},
+				cli.StringFlag{
+					Name:  "expect-value",
+					Usage: "expected value (e.g. 1000000, 2gwei, 0.5ether)",
+				},
+				cli.StringFlag{
+					Name:  "expect-nonce",
+					Usage: "expected nonce",
+				},
+				cli.StringFlag{
+					Name:  "expect-chain-id",
+					Usage: "expected chain ID",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if (c.String("raw") == "") == (c.String("cbor") == "") {
+					return cli.NewExitError("ethsign: need exactly one of --raw or --cbor", 1)
+				}
+
+				var raw []byte
+				var recorded *cborTx
+				if c.String("cbor") != "" {
+					contents, err := ioutil.ReadFile(c.String("cbor"))
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to read --cbor file", 1)
+					}
+					if recorded, err = decodeCBORTx(contents); err != nil {
+						return cli.NewExitError("ethsign: invalid --cbor: "+err.Error(), 1)
+					}
+					raw = recorded.raw
+				} else {
+					var err error
+					if raw, err = parseHex(c.String("raw")); err != nil {
+						return cli.NewExitError("ethsign: invalid --raw: "+err.Error(), 1)
+					}
+				}
+
+				tx, err := decodeRawTx(raw)
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to decode --raw: "+err.Error(), 1)
+				}
+
+				var expect txExpectations
+				if c.String("expect-from") != "" {
+					from := common.HexToAddress(c.String("expect-from"))
+					expect.from = &from
+				}
+				expect.to = c.String("expect-to")
+				if c.String("expect-value") != "" {
+					if expect.value, err = parseAmount(c.String("expect-value")); err != nil {
+						return cli.NewExitError("ethsign: invalid --expect-value: "+err.Error(), 1)
+					}
+				}
+				if c.String("expect-nonce") != "" {
+					nonce, ok := math.ParseUint64(c.String("expect-nonce"))
+					if !ok {
+						return cli.NewExitError("ethsign: invalid --expect-nonce", 1)
+					}
+					expect.nonce = &nonce
+				}
+				if c.String("expect-chain-id") != "" {
+					chainID, ok := math.ParseBig256(c.String("expect-chain-id"))
+					if !ok {
+						return cli.NewExitError("ethsign: invalid --expect-chain-id", 1)
+					}
+					expect.chainID = chainID
+				}
+
+				mismatches := tx.check(recorded, expect)
+				for _, m := range mismatches {
+					fmt.Fprintf(os.Stderr, "ethsign: %s\n", m)
+				}
+				if len(mismatches) > 0 {
+					return cli.NewExitError(fmt.Sprintf("ethsign: %d field(s) did not match", len(mismatches)), 1)
+				}
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "resign-chain",
+			Usage: "sign the transaction in a raw signed transaction again for another chain ID, by the original signer unless --from is given",
+			Flags: append(accountFlags,
+				cli.StringFlag{
+					Name:  "raw",
+					Usage: "raw signed transaction as hex",
+				},
+				cli.StringFlag{
+					Name:  "chain-id",
+					Usage: "chain ID to sign for",
+				},
+				cli.BoolFlag{
+					Name:  "allow-future-chain-id",
+					Usage: "sign for a chain ID that is not a known network",
+				},
+			),
+			Action: func(c *cli.Context) error {
+				if err := applyFrom(c, defaultKeyStores); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				requireds := []string{
+					"raw", "chain-id",
+				}
+
+				for _, required := range requireds {
+					if c.String(required) == "" {
+						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
 					}
 				}
 
-				if acct == nil {
-					return cli.NewExitError(
-						"ethsign: account not found",
-						1,
-					)
+				raw, err := parseHex(c.String("raw"))
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --raw: "+err.Error(), 1)
 				}
 
+				original, err := decodeRawTx(raw)
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to decode --raw: "+err.Error(), 1)
+				}
+				originalFrom := original.from
 
-				passphrase := ""
+				chainID, ok := math.ParseBig256(c.String("chain-id"))
+				if !ok {
+					return cli.NewExitError("ethsign: invalid --chain-id", 1)
+				}
+				if err := checkChainID(chainID, c.Bool("allow-future-chain-id")); err != nil {
+					return cli.NewExitError(err, 1)
+				}
 
-				if needPassphrase {
-					if c.String("passphrase-file") != "" {
-						passphraseFile, err := ioutil.ReadFile(c.String("passphrase-file"))
-						if err != nil {
-							return cli.NewExitError("ethsign: failed to read passphrase file", 1)
-						}
-						
-						passphrase = strings.TrimSuffix(string(passphraseFile), "\n")
-					} else {
-						fmt.Fprintf(os.Stderr, "Ethereum account passphrase (not echoed): ")
-						bytes, err := terminal.ReadPassword(int(syscall.Stdin))
-						if err != nil {
-							return cli.NewExitError("ethsign: failed to read passphrase", 1)
-						} else {
-							passphrase = string(bytes)
-						}
+				if original.chainID != nil {
+					if original.chainID.Cmp(chainID) == 0 {
+						return cli.NewExitError("ethsign: --raw is already signed for chain ID "+chainID.String(), 1)
 					}
+					fmt.Fprintf(os.Stderr, "Warning: re-signing a transaction from %s for %s\n", chainName(original.chainID), chainName(chainID))
 				} else {
-					fmt.Fprintf(os.Stderr, "Waiting for hardware wallet confirmation...\n")
+					fmt.Fprintf(os.Stderr, "Warning: --raw has no chain ID and can already be replayed on any chain\n")
+				}
+
+				from := originalFrom
+				if c.String("from") != "" {
+					from = common.HexToAddress(c.String("from"))
+					if from != originalFrom {
+						fmt.Fprintf(os.Stderr, "Warning: --raw was signed by %s, not --from %s; the nonce may not match\n", originalFrom.Hex(), from.Hex())
+					}
 				}
 
+				// A typed transaction keeps its type and fees and is
+				// described through a legacy one priced at its max fee.
+				var ttx *typedTx
 				var tx *types.Transaction
-				if create {
-					tx = types.NewContractCreation(nonce, value, gasLimit, gasPrice, data)
+				if original.typed != nil {
+					resigned := *original.typed
+					resigned.ChainID = chainID
+					resigned.V, resigned.R, resigned.S = nil, nil, nil
+					ttx = &resigned
+				}
+				if original.legacy != nil {
+					if original.to == nil {
+						tx = types.NewContractCreation(original.nonce, original.value, original.legacy.Gas(), original.legacy.GasPrice(), original.legacy.Data())
+					} else {
+						tx = types.NewTransaction(original.nonce, *original.to, original.value, original.legacy.Gas(), original.legacy.GasPrice(), original.legacy.Data())
+					}
+				} else if ttx.To == nil {
+					tx = types.NewContractCreation(ttx.Nonce, ttx.Value, ttx.Gas, ttx.maxGasPrice(), ttx.Data)
 				} else {
-					tx = types.NewTransaction(nonce, to, value, gasLimit, gasPrice, data)
+					tx = types.NewTransaction(ttx.Nonce, *ttx.To, ttx.Value, ttx.Gas, ttx.maxGasPrice(), ttx.Data)
+				}
+
+				fmt.Fprintf(os.Stderr, "%s\n", describeTx(tx, from, chainID, "ether"))
+
+				if ttx != nil && onHardwareWallet(c, defaultKeyStores, from) {
+					return cli.NewExitError("ethsign: --raw is a typed transaction, and hardware wallets can only sign legacy transactions", 1)
+				}
+
+				wallets := getWallets(c, defaultKeyStores, true)
+				wallet, acct, passphrase, err := unlockAccount(c, wallets, from)
+				if err != nil {
+					return cli.NewExitError(err, 1)
+				}
+
+				if ttx != nil {
+					if wallet.URL().Scheme != "keystore" {
+						return cli.NewExitError("ethsign: hardware wallets can only sign legacy transactions", 1)
+					}
+					_, encoded, err := signTypedTx(wallet, *acct, passphrase, ttx)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to sign tx", 1)
+					}
+					mismatches, err := verifyTypedTx(encoded, ttx, from)
+					if err != nil || len(mismatches) > 0 {
+						return cli.NewExitError("ethsign: signed transaction does not match --raw", 1)
+					}
+					fmt.Println(hexutil.Encode(encoded))
+					return nil
 				}
 
 				signed, err := wallet.SignTxWithPassphrase(*acct, passphrase, tx, chainID)
@@ -339,215 +3479,241 @@ func main() {
 					return cli.NewExitError("ethsign: failed to sign tx", 1)
 				}
 
-				signature := c.Bool("sig")
-				if(signature){
-					v, r, s := signed.RawSignatureValues()
-					fmt.Println(fmt.Sprintf("0x%064x%064x%02x", r, s, v))
-				}else{
-					encoded, _ := rlp.EncodeToBytes(signed)
-					fmt.Println(hexutil.Encode(encoded[:]))
-				}
+				encoded, _ := rlp.EncodeToBytes(signed)
+				fmt.Println(hexutil.Encode(encoded))
+
 				return nil
 			},
 		},
 
 		cli.Command{
-			Name:    "message",
-			Aliases: []string{"msg"},
-			Usage:   "sign arbitrary data with header prefix",
+			Name:  "predict-addresses",
+			Usage: "print the addresses of contracts created by an account's next transactions",
 			Flags: []cli.Flag{
-				cli.StringSliceFlag{
-					Name:   "key-store",
-					Usage:  "path to key store",
-					EnvVar: "ETH_KEYSTORE",
-				},
 				cli.StringFlag{
 					Name:   "from",
-					Usage:  "address of signing account",
-					EnvVar: "ETH_FROM",
+					Usage:  "address of deploying account, or an alias for it in the config file",
+					EnvVar: "ETHSIGN_FROM,ETH_FROM",
+				},
+				cli.IntFlag{
+					Name:  "count",
+					Usage: "number of addresses to predict",
+					Value: 1,
 				},
 				cli.StringFlag{
-					Name:  "passphrase-file",
-					Usage: "path to file containing account passphrase",
+					Name:  "nonce",
+					Usage: "nonce of the first deployment (default: pending nonce from --rpc-url)",
 				},
 				cli.StringFlag{
-					Name:  "data",
-					Usage: "hex data to sign",
+					Name:   "rpc-url",
+					Usage:  "URL of the Ethereum JSON-RPC node",
+					EnvVar: "ETHSIGN_RPC_URL,ETH_RPC_URL",
 				},
 			},
 			Action: func(c *cli.Context) error {
-				requireds := []string{
-					"from", "data",
+				if c.String("from") == "" {
+					return cli.NewExitError("ethsign: missing required parameter --from", 1)
 				}
-
-				for _, required := range requireds {
-					if c.String(required) == "" {
-						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
-					}
+				if err := applyFromAlias(c); err != nil {
+					return cli.NewExitError(err, 1)
+				}
+				if c.String("nonce") == "" && c.String("rpc-url") == "" {
+					return cli.NewExitError("ethsign: need --nonce or --rpc-url", 1)
 				}
 
 				from := common.HexToAddress(c.String("from"))
 
-				dataString := c.String("data")
-				if !strings.HasPrefix(dataString, "0x") {
-					dataString = "0x" + dataString
+				var nonce uint64
+				if c.String("nonce") != "" {
+					var ok bool
+					nonce, ok = math.ParseUint64(c.String("nonce"))
+					if !ok {
+						return cli.NewExitError("ethsign: invalid --nonce", 1)
+					}
+				} else {
+					var err error
+					nonce, err = pendingNonce(c.String("rpc-url"), c.GlobalDuration("rpc-timeout"), from)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to fetch pending nonce: "+err.Error(), 1)
+					}
+				}
+
+				for i := 0; i < c.Int("count"); i++ {
+					fmt.Printf("%s %d\n", crypto.CreateAddress(from, nonce+uint64(i)).Hex(), nonce+uint64(i))
 				}
-				data := hexutil.MustDecode(dataString)
 
-				backends := []accounts.Backend{ }
+				return nil
+			},
+		},
 
-				var paths []string
-				if len(c.StringSlice("key-store")) == 0 {
+		cli.Command{
+			Name:  "gen-key",
+			Usage: "generate a throwaway key for testing",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "show-private",
+					Usage: "also print the private key",
+				},
+				cli.BoolFlag{
+					Name:  "import",
+					Usage: "save the key in the key store",
+				},
+				cli.StringSliceFlag{
+					Name:   "key-store",
+					Usage:  "path to key store",
+					EnvVar: "ETHSIGN_KEYSTORE,ETH_KEYSTORE",
+				},
+				cli.StringFlag{
+					Name:   "passphrase-file",
+					Usage:  "path to file containing passphrase for the imported key",
+					EnvVar: "ETHSIGN_PASSPHRASE_FILE",
+				},
+				cli.BoolFlag{
+					Name:  "passphrase-stdin",
+					Usage: "read passphrase for the imported key from the first line of stdin",
+				},
+				cli.StringFlag{
+					Name:  "keyfile-name",
+					Usage: "file name for the imported key instead of UTC--<time>--<address>",
+				},
+				cli.StringFlag{
+					Name:  "kdf",
+					Usage: "key derivation function for the imported key: scrypt, or pbkdf2 for older tools",
+					Value: "scrypt",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				paths := c.StringSlice("key-store")
+				if len(paths) == 0 {
 					paths = defaultKeyStores
-				} else {
-					paths = c.StringSlice("key-store")
-				}
-				for _, x := range(paths) {
-					ks := keystore.NewKeyStore(
-						x, keystore.StandardScryptN, keystore.StandardScryptP)
-					backends = append(backends, ks)
 				}
 
-				if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
-					fmt.Fprintf(os.Stderr, "ethsign: failed to look for USB Ledgers")
-				} else {
-					backends = append(backends, ledgerhub)
-				}
-				if trezorhub, err := usbwallet.NewTrezorHub(); err != nil {
-					fmt.Fprintf(os.Stderr, "ethsign: failed to look for USB Trezors")
-				} else {
-					backends = append(backends, trezorhub)
+				if c.String("kdf") != "scrypt" && c.String("kdf") != "pbkdf2" {
+					return cli.NewExitError("ethsign: --kdf must be scrypt or pbkdf2", 1)
 				}
 
-				manager := accounts.NewManager(backends...)
-				wallets := manager.Wallets()
-
-				var wallet accounts.Wallet
-				var acct *accounts.Account
-
-				needPassphrase := true
+				if c.String("keyfile-name") != "" {
+					if !c.Bool("import") {
+						return cli.NewExitError("ethsign: --keyfile-name needs --import", 1)
+					}
+					if err := checkKeyFileName(paths[0], c.String("keyfile-name")); err != nil {
+						return cli.NewExitError(err, 1)
+					}
+				}
 
-			Scan:
-				for _, x := range wallets {
-					if x.URL().Scheme == "keystore" {
-						for _, y := range x.Accounts() {
-							if y.Address == from {
-								wallet = x
-								acct = &y
-								break Scan
-							}
-						}
-					} else if x.URL().Scheme == "ledger" {
-						x.Open("")
-						for j := 0; j <= 3; j++ {
-							pathstr := fmt.Sprintf("m/44'/60'/0'/%d", j)
-							path, _ := accounts.ParseDerivationPath(pathstr)
-							y, err := x.Derive(path, true)
-							if err != nil {
-								return cli.NewExitError("ethsign: Ledger needs to be in Ethereum app with browser support off", 1)
-							}
-							if y.Address == from {
-								wallet = x
-								acct = &y
-								needPassphrase = false
-								break Scan
-							}
-						}
+				// Ask for the passphrase first so that a mistyped one
+				// does not waste a key that has already been printed.
+				var passphrase string
+				if c.Bool("import") {
+					var err error
+					if passphrase, err = getNewPassphrase(c); err != nil {
+						return cli.NewExitError(err, 1)
 					}
 				}
 
-				if acct == nil {
-					return cli.NewExitError(
-						"ethsign: account not found",
-						1,
-					)
+				key, err := crypto.GenerateKey()
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to generate key", 1)
 				}
 
-				passphrase := ""
+				fmt.Println(crypto.PubkeyToAddress(key.PublicKey).Hex())
 
-				if needPassphrase {
-					if c.String("passphrase-file") != "" {
-						passphraseFile, err := ioutil.ReadFile(c.String("passphrase-file"))
-						if err != nil {
-							return cli.NewExitError("ethsign: failed to read passphrase file", 1)
-						}
+				if c.Bool("show-private") {
+					fmt.Fprintf(os.Stderr, "WARNING: printing the private key. Anyone who sees it controls this account.\n")
+					fmt.Println(hexutil.Encode(crypto.FromECDSA(key)))
+				}
 
-						passphrase = strings.TrimSuffix(string(passphraseFile), "\n")
+				if c.Bool("import") {
+					var path string
+					if c.String("kdf") == "pbkdf2" {
+						if path, err = writePBKDF2KeyFile(paths[0], key, passphrase, pbkdf2Iterations); err != nil {
+							return cli.NewExitError("ethsign: failed to import key: "+err.Error(), 1)
+						}
 					} else {
-						fmt.Fprintf(os.Stderr, "Ethereum account passphrase (not echoed): ")
-						bytes, err := terminal.ReadPassword(int(syscall.Stdin))
+						ks := keystore.NewKeyStore(
+							paths[0], keystore.StandardScryptN, keystore.StandardScryptP)
+						acct, err := ks.ImportECDSA(key, passphrase)
 						if err != nil {
-							return cli.NewExitError("ethsign: failed to read passphrase", 1)
+							return cli.NewExitError("ethsign: failed to import key: "+err.Error(), 1)
 						}
-						passphrase = string(bytes)
+						path = acct.URL.Path
 					}
-				} else {
-					fmt.Fprintf(os.Stderr, "Waiting for hardware wallet confirmation...\n")
-				}
-
-				signature, err := wallet.SignHashWithPassphrase(*acct, passphrase, signHash(data))
-
-				if err != nil {
-					return cli.NewExitError("ethsign: failed to sign message", 1)
+					if c.String("keyfile-name") != "" {
+						if path, err = renameKeyFile(path, c.String("keyfile-name")); err != nil {
+							return cli.NewExitError("ethsign: failed to rename key file: "+err.Error(), 1)
+						}
+					}
+					fmt.Fprintf(os.Stderr, "Saved key to %s\n", path)
 				}
 
-				signature[64] += 27 // Transform V from 0/1 to 27/28 according to the yellow paper
-
-				fmt.Println(hexutil.Encode(signature))
-
 				return nil
 			},
 		},
 
 		cli.Command{
-			Name:    "verify",
-			Usage:   "verify signed data by given key",
+			Name:  "mnemonic-address",
+			Usage: "print the addresses a BIP-39 mnemonic controls",
 			Flags: []cli.Flag{
 				cli.StringFlag{
-					Name:   "from",
-					Usage:  "address to verify",
+					Name:  "mnemonic-file",
+					Usage: "path to file containing the mnemonic",
 				},
 				cli.StringFlag{
-					Name:  "data",
-					Usage: "hex data to verify",
+					Name:  "path",
+					Usage: "derivation path of the first address",
+					Value: "m/44'/60'/0'/0/0",
 				},
-				cli.StringFlag{
-					Name:  "sig",
-					Usage: "signature",
+				cli.IntFlag{
+					Name:  "count",
+					Usage: "number of addresses to derive, incrementing the last path component",
+					Value: 1,
+				},
+				cli.BoolFlag{
+					Name:  "show-private",
+					Usage: "also print the private keys",
 				},
 			},
 			Action: func(c *cli.Context) error {
-				requireds := []string{
-					"from", "data", "sig",
+				if c.String("mnemonic-file") == "" {
+					return cli.NewExitError("ethsign: missing required parameter --mnemonic-file", 1)
 				}
 
-				for _, required := range requireds {
-					if c.String(required) == "" {
-						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
-					}
+				mnemonic, err := ioutil.ReadFile(c.String("mnemonic-file"))
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to read --mnemonic-file", 1)
 				}
 
-				from := common.HexToAddress(c.String("from"))
-
-				dataString := c.String("data")
-				if !strings.HasPrefix(dataString, "0x") {
-					dataString = "0x" + dataString
+				path, err := accounts.ParseDerivationPath(c.String("path"))
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid --path: "+err.Error(), 1)
 				}
-				data := hexutil.MustDecode(dataString)
 
-				sigString := c.String("sig")
-				if !strings.HasPrefix(sigString, "0x") {
-					sigString = "0x" + sigString
+				seed, err := mnemonicSeed(string(mnemonic), "")
+				if err != nil {
+					return cli.NewExitError("ethsign: invalid mnemonic: "+err.Error(), 1)
 				}
-				sig := hexutil.MustDecode(sigString)
 
-				recoveredAddr, err := recover(data, sig)
+				master, err := newMasterKey(seed)
 				if err != nil {
-					return cli.NewExitError(err, 1)
+					return cli.NewExitError("ethsign: failed to derive master key: "+err.Error(), 1)
 				}
 
-				if from != recoveredAddr {
-					return cli.NewExitError("ethsign: address did not match. Wanted "+from.String()+" got "+recoveredAddr.String(), 1)
+				if c.Bool("show-private") {
+					fmt.Fprintf(os.Stderr, "WARNING: printing private keys. Anyone who sees them controls these accounts.\n")
+				}
+
+				for i := 0; i < c.Int("count"); i++ {
+					key, err := master.derive(path)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to derive "+path.String()+": "+err.Error(), 1)
+					}
+					address := crypto.PubkeyToAddress(key.key.PublicKey)
+					if c.Bool("show-private") {
+						fmt.Printf("%s %s %s\n", address.Hex(), path, hexutil.Encode(crypto.FromECDSA(key.key)))
+					} else {
+						fmt.Printf("%s %s\n", address.Hex(), path)
+					}
+					path[len(path)-1]++
 				}
 
 				return nil
@@ -555,48 +3721,244 @@ func main() {
 		},
 
 		cli.Command{
-			Name:    "recover",
-			Usage:   "recover ethereum address from signature",
+			Name:  "broadcast-spool",
+			Usage: "broadcast spooled transactions in nonce order",
 			Flags: []cli.Flag{
 				cli.StringFlag{
-					Name:  "data",
-					Usage: "hex data to verify",
+					Name:  "spool-dir",
+					Usage: "directory of spooled transactions, which are all legacy",
+				},
+				cli.StringSliceFlag{
+					Name:   "rpc-url",
+					Usage:  "URL of an Ethereum JSON-RPC node (repeat to broadcast to several)",
+					EnvVar: "ETHSIGN_RPC_URL,ETH_RPC_URL",
+				},
+				cli.IntFlag{
+					Name:  "rpc-retries",
+					Usage: "times to retry a broadcast that failed for a possibly transient reason",
+					Value: 3,
+				},
+				cli.DurationFlag{
+					Name:  "rpc-retry-delay",
+					Usage: "wait before the first retry, doubling after each attempt",
+					Value: time.Second,
+				},
+				cli.BoolFlag{
+					Name:  "verbose",
+					Usage: "report each failed broadcast attempt",
+				},
+				cli.BoolFlag{
+					Name:  "only-if-nonce-matches",
+					Usage: "skip a transaction unless its nonce is the sender's pending nonce on every node",
 				},
 				cli.StringFlag{
-					Name:  "sig",
-					Usage: "signature",
+					Name:  "relay",
+					Usage: "submit privately to a relay instead of --rpc-url: flashbots",
+				},
+				cli.StringFlag{
+					Name:  "relay-url",
+					Usage: "relay endpoint",
+					Value: flashbotsRelay,
+				},
+				cli.StringFlag{
+					Name:  "relay-key-file",
+					Usage: "hex private key identifying you to the relay (a throwaway key is made if not given)",
+				},
+				cli.BoolFlag{
+					Name:  "print-json-rpc-batch",
+					Usage: "print a JSON-RPC batch of eth_sendRawTransaction calls instead of broadcasting",
+				},
+				cli.IntFlag{
+					Name:  "json-indent",
+					Usage: "spaces per indentation level in JSON output (0 for a single line)",
 				},
 			},
 			Action: func(c *cli.Context) error {
-				requireds := []string{
-					"data", "sig",
+				if c.String("spool-dir") == "" {
+					return cli.NewExitError("ethsign: missing required parameter --spool-dir", 1)
 				}
 
-				for _, required := range requireds {
-					if c.String(required) == "" {
-						return cli.NewExitError("ethsign: missing required parameter --"+required, 1)
+				if c.Bool("print-json-rpc-batch") {
+					spooled, err := readSpool(c.String("spool-dir"))
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to read spool: "+err.Error(), 1)
+					}
+					var txs []*types.Transaction
+					for _, x := range spooled {
+						txs = append(txs, x.tx)
 					}
+					batch, err := sendRawBatch(txs)
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to encode tx", 1)
+					}
+					out, err := marshalJSON(batch, c.Int("json-indent"))
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to encode batch", 1)
+					}
+					fmt.Println(string(out))
+					return nil
+				}
+
+				if c.String("relay") != "" {
+					if c.String("relay") != "flashbots" {
+						return cli.NewExitError("ethsign: --relay must be flashbots", 1)
+					}
+
+					var authKey *ecdsa.PrivateKey
+					var err error
+					if c.String("relay-key-file") != "" {
+						authKey, err = crypto.LoadECDSA(c.String("relay-key-file"))
+					} else {
+						authKey, err = crypto.GenerateKey()
+					}
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to load relay key: "+err.Error(), 1)
+					}
+
+					spooled, err := readSpool(c.String("spool-dir"))
+					if err != nil {
+						return cli.NewExitError("ethsign: failed to read spool: "+err.Error(), 1)
+					}
+
+					r := newRelay(c.String("relay-url"), authKey, c.GlobalDuration("rpc-timeout"))
+					failed := 0
+					for _, x := range spooled {
+						result, err := r.sendPrivateTransaction(x.tx)
+						if err != nil {
+							fmt.Fprintf(os.Stderr, "ethsign: relay rejected %s: %v\n", x.tx.Hash().Hex(), err)
+							failed++
+							continue
+						}
+						fmt.Fprintf(os.Stderr, "Relay accepted %s: %s\n", x.tx.Hash().Hex(), result)
+						os.Remove(x.path)
+						fmt.Println(x.tx.Hash().Hex())
+					}
+
+					if failed > 0 {
+						return cli.NewExitError(fmt.Sprintf("ethsign: %d of %d transactions failed to reach the relay", failed, len(spooled)), 1)
+					}
+					return nil
 				}
 
-				dataString := c.String("data")
-				if !strings.HasPrefix(dataString, "0x") {
-					dataString = "0x" + dataString
+				if len(c.StringSlice("rpc-url")) == 0 {
+					return cli.NewExitError("ethsign: missing required parameter --rpc-url", 1)
+				}
+				if c.Int("rpc-retries") < 0 {
+					return cli.NewExitError("ethsign: --rpc-retries must not be negative", 1)
 				}
-				data := hexutil.MustDecode(dataString)
 
-				sigString := c.String("sig")
-				if !strings.HasPrefix(sigString, "0x") {
-					sigString = "0x" + sigString
+				spooled, err := readSpool(c.String("spool-dir"))
+				if err != nil {
+					return cli.NewExitError("ethsign: failed to read spool: "+err.Error(), 1)
 				}
-				sig := hexutil.MustDecode(sigString)
 
-				recoveredAddr, err := recover(data, sig)
+				nodes, err := dialNodes(c.StringSlice("rpc-url"), c.GlobalDuration("rpc-timeout"))
 				if err != nil {
-					return cli.NewExitError(err, 1)
+					return cli.NewExitError("ethsign: failed to connect to --rpc-url "+err.Error(), 1)
 				}
+				defer closeNodes(nodes)
 
-				fmt.Println(recoveredAddr.String())
+				chainIDs := make([]*big.Int, len(nodes))
+				for i, node := range nodes {
+					if chainIDs[i], err = node.chainID(); err != nil {
+						return cli.NewExitError("ethsign: failed to fetch chain ID from " + node.url + ": " + err.Error(), 1)
+					}
+				}
+
+				retry := retryPolicy{c.Int("rpc-retries"), c.Duration("rpc-retry-delay"), c.Bool("verbose")}
+
+				failed := 0
+				for _, x := range spooled {
+					// Transactions without EIP-155 replay protection can be
+					// sent anywhere; the rest only to nodes on their chain.
+					var targets []*rpcNode
+					for i, node := range nodes {
+						if x.tx.Protected() && chainIDs[i].Cmp(x.tx.ChainId()) != 0 {
+							fmt.Fprintf(os.Stderr, "ethsign: %s is on chain ID %s, not %s; not sending %s there\n", node.url, chainIDs[i], x.tx.ChainId(), x.tx.Hash().Hex())
+							continue
+						}
+						targets = append(targets, node)
+					}
+					if c.Bool("only-if-nonce-matches") {
+						if err := checkPendingNonce(targets, x.tx); err != nil {
+							fmt.Fprintf(os.Stderr, "ethsign: not sending %s: %v\n", x.tx.Hash().Hex(), err)
+							failed++
+							continue
+						}
+					}
+					if broadcast(targets, x.tx, retry) == 0 {
+						fmt.Fprintf(os.Stderr, "ethsign: failed to broadcast %s\n", x.tx.Hash().Hex())
+						failed++
+						continue
+					}
+					os.Remove(x.path)
+					fmt.Println(x.tx.Hash().Hex())
+				}
 
+				if failed > 0 {
+					return cli.NewExitError(fmt.Sprintf("ethsign: %d of %d transactions failed to broadcast", failed, len(spooled)), 1)
+				}
+
+				return nil
+			},
+		},
+
+		cli.Command{
+			Name:  "repl",
+			Usage: "read and run commands from stdin, keeping wallets open between them",
+			Action: func(c *cli.Context) error {
+				walletCache = map[string][]accounts.Wallet{}
+
+				// Errors are printed and the session carries on.
+				cli.OsExiter = func(int) {}
+
+				global := globalArgs(c)
+
+				for {
+					line, err := stdin.ReadString('\n')
+					if line == "" && err != nil {
+						return nil
+					}
+
+					args, splitErr := splitWords(strings.TrimSpace(line))
+					if splitErr != nil {
+						fmt.Fprintln(os.Stderr, splitErr)
+						continue
+					}
+					if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+						continue
+					}
+					if args[0] == "repl" {
+						fmt.Fprintln(os.Stderr, "ethsign: already in a repl session")
+						continue
+					}
+
+					argv := append([]string{c.App.Name}, global...)
+					c.App.Run(append(argv, args...))
+				}
+			},
+		},
+
+		cli.Command{
+			Name:  "serve",
+			Usage: "run commands sent as JSON lines over a Unix socket, keeping wallets open between them",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "socket",
+					Usage: "path of the Unix socket to listen on, which only the current user can use",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.String("socket") == "" {
+					return cli.NewExitError("ethsign: missing required parameter --socket", 1)
+				}
+
+				walletCache = map[string][]accounts.Wallet{}
+				cli.OsExiter = func(int) {}
+
+				if err := serve(c.App, c.String("socket"), globalArgs(c)); err != nil {
+					return cli.NewExitError(err, 1)
+				}
 				return nil
 			},
 		},
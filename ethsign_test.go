@@ -0,0 +1,152 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestRecoverVEncodings signs a message the way the message command does
+// and checks that recover accepts it with every V encoding and format
+// that command can print.
+func TestRecoverVEncodings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethsign-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	acct, err := ks.NewAccount("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("hello")
+	sig, err := ks.SignHashWithPassphrase(acct, "test", signHash(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	yellow := append([]byte{}, sig...)
+	yellow[64] += 27
+
+	tests := []struct {
+		name string
+		sig  []byte
+	}{
+		{"--v-encoding 0", sig},
+		{"--v-encoding 27", yellow},
+		{"--format compact", compactSignature(sig)},
+	}
+	for _, test := range tests {
+		input := append([]byte{}, test.sig...)
+		got, err := recover(data, input)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != acct.Address {
+			t.Errorf("%s: recovered %s, want %s", test.name, got.Hex(), acct.Address.Hex())
+		}
+		if string(input) != string(test.sig) {
+			t.Errorf("%s: recover modified the signature", test.name)
+		}
+	}
+
+	bad := append([]byte{}, sig...)
+	bad[64] = 29
+	if _, err := recover(data, bad); err == nil {
+		t.Errorf("V of 29: expected an error")
+	}
+}
+
+func TestValidatorPreimage(t *testing.T) {
+	validator := common.HexToAddress("0x5B38Da6a701c568545dCfcB03FcB875f56beddC4")
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"0x", "0x19005b38da6a701c568545dcfcb03fcb875f56beddc4"},
+		{"0x1234", "0x19005b38da6a701c568545dcfcb03fcb875f56beddc41234"},
+		// No decimal length is inserted, unlike the personal message
+		// preimage, even for data that starts with digits.
+		{"0x3132", "0x19005b38da6a701c568545dcfcb03fcb875f56beddc43132"},
+	}
+	for _, test := range tests {
+		data, err := parseHex(test.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hexutil.Encode(validatorPreimage(validator, data)); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.data, got, test.want)
+		}
+	}
+
+	personal := hexutil.Encode(signPreimage([]byte("12")))
+	if want := "0x19457468657265756d205369676e6564204d6573736167653a0a323132"; personal != want {
+		t.Errorf("personal preimage: got %s, want %s", personal, want)
+	}
+}
+
+func TestParseHex(t *testing.T) {
+	tests := []struct {
+		input  string
+		want   string
+		strict bool
+	}{
+		{"0x12ab", "0x12ab", true},
+		{"0x", "0x", true},
+		{"12ab", "0x12ab", false},
+		{"0X12AB", "0x12ab", false},
+		{" 0x12ab\n", "0x12ab", false},
+		{"0x12a", "", false},
+		{"0xzz", "", false},
+	}
+	for _, test := range tests {
+		got, err := parseHex(test.input)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.input)
+			}
+		} else if err != nil || hexutil.Encode(got) != test.want {
+			t.Errorf("%q: got %x, %v, want %s", test.input, got, err, test.want)
+		}
+
+		_, err = parseStrictHex(test.input)
+		if test.strict && err != nil {
+			t.Errorf("%q strictly: %v", test.input, err)
+		} else if !test.strict && err == nil {
+			t.Errorf("%q strictly: expected an error", test.input)
+		}
+	}
+}
+
+func TestEncodeData(t *testing.T) {
+	data := appendNonce([]byte("hello"), []byte{0xab, 0xcd}, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	tests := []struct {
+		encoding string
+		want     string
+	}{
+		{"hex", hexutil.Encode(data)},
+		{"text", string(data)},
+		{"base64", base64.StdEncoding.EncodeToString(data)},
+	}
+	for _, test := range tests {
+		encoded := encodeData(data, test.encoding)
+		if encoded != test.want {
+			t.Errorf("%s: got %q, want %q", test.encoding, encoded, test.want)
+		}
+		decoded, err := decodeData(encoded, test.encoding)
+		if err != nil {
+			t.Errorf("%s: %v", test.encoding, err)
+		} else if !bytes.Equal(decoded, data) {
+			t.Errorf("%s: round trip gave %q, want %q", test.encoding, decoded, data)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+// feePreset evaluates the named fee preset from the config against the
+// latest base fee and the suggested priority fee ("tip") of the node.
+func feePreset(conf *config, name string, node *rpcNode) (*big.Int, error) {
+	expr, ok := conf.FeePresets[name]
+	if !ok {
+		return nil, fmt.Errorf("no fee preset %q in the config", name)
+	}
+	baseFee, err := node.baseFee()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch base fee: %v", err)
+	}
+	if baseFee == nil {
+		return nil, fmt.Errorf("%s has no base fee; fee presets need an EIP-1559 chain", node.url)
+	}
+	tip, err := node.suggestTip()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch priority fee: %v", err)
+	}
+	fee, err := evalFeeExpr(expr, map[string]*big.Int{"baseFee": baseFee, "tip": tip})
+	if err != nil {
+		return nil, fmt.Errorf("fee preset %q: %v", name, err)
+	}
+	return fee, nil
+}
+
+// evalFeeExpr evaluates a fee preset expression such as
+// "baseFee*3 + 3gwei" to an amount of wei. Expressions combine the
+// variables in vars with amounts as parseAmount reads them, +, -, *, /
+// and parentheses. Arithmetic is exact and the result is rounded down.
+func evalFeeExpr(expr string, vars map[string]*big.Int) (*big.Int, error) {
+	p := &feeParser{expr: expr, vars: vars}
+	value, err := p.sum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.expr) {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.expr[p.pos:], p.pos+1)
+	}
+	if value.Sign() < 0 {
+		return nil, fmt.Errorf("%q is negative", expr)
+	}
+	return new(big.Int).Quo(value.Num(), value.Denom()), nil
+}
+
+type feeParser struct {
+	expr string
+	pos  int
+	vars map[string]*big.Int
+}
+
+func (p *feeParser) skipSpace() {
+	for p.pos < len(p.expr) && p.expr[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// sum parses terms separated by + and -.
+func (p *feeParser) sum() (*big.Rat, error) {
+	value, err := p.product()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if p.pos == len(p.expr) || (p.expr[p.pos] != '+' && p.expr[p.pos] != '-') {
+			return value, nil
+		}
+		op := p.expr[p.pos]
+		p.pos++
+		term, err := p.product()
+		if err != nil {
+			return nil, err
+		}
+		if op == '+' {
+			value.Add(value, term)
+		} else {
+			value.Sub(value, term)
+		}
+	}
+}
+
+// product parses factors separated by * and /.
+func (p *feeParser) product() (*big.Rat, error) {
+	value, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if p.pos == len(p.expr) || (p.expr[p.pos] != '*' && p.expr[p.pos] != '/') {
+			return value, nil
+		}
+		op := p.expr[p.pos]
+		p.pos++
+		factor, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		if op == '*' {
+			value.Mul(value, factor)
+		} else if factor.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		} else {
+			value.Quo(value, factor)
+		}
+	}
+}
+
+// factor parses a parenthesized sum, a variable or a number. A number
+// followed by a unit is an amount in wei; a bare number such as the 1.5
+// in "baseFee*1.5" is kept exact.
+func (p *feeParser) factor() (*big.Rat, error) {
+	p.skipSpace()
+	if p.pos == len(p.expr) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+
+	if p.expr[p.pos] == '(' {
+		p.pos++
+		value, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.pos == len(p.expr) || p.expr[p.pos] != ')' {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return value, nil
+	}
+
+	start := p.pos
+	for p.pos < len(p.expr) && (unicode.IsLetter(rune(p.expr[p.pos])) || unicode.IsDigit(rune(p.expr[p.pos])) || p.expr[p.pos] == '.') {
+		p.pos++
+	}
+	word := p.expr[start:p.pos]
+	if word == "" {
+		return nil, fmt.Errorf("unexpected %q at position %d", p.expr[p.pos:p.pos+1], p.pos+1)
+	}
+
+	if unicode.IsLetter(rune(word[0])) {
+		value, ok := p.vars[word]
+		if !ok {
+			return nil, fmt.Errorf("unknown variable %q", word)
+		}
+		return new(big.Rat).SetInt(value), nil
+	}
+	if strings.IndexFunc(word, unicode.IsLetter) >= 0 {
+		amount, err := parseAmount(word)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Rat).SetInt(amount), nil
+	}
+	value, ok := new(big.Rat).SetString(word)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q", word)
+	}
+	return value, nil
+}
+
+// chooseTxType picks the type of transaction to sign: the one given with
+// --tx-type, type 2 if EIP-1559 fee caps are given, legacy if a gas price
+// is, and otherwise type 2 if node's chain has a base fee. node may be
+// nil when there is no --rpc-url, which means legacy.
+func chooseTxType(explicit string, gasPrice, feeCaps bool, node *rpcNode) (int, error) {
+	if explicit != "" {
+		var txType int
+		switch explicit {
+		case "legacy", "0":
+			txType = 0
+		case "1":
+			txType = accessListTxType
+		case "2":
+			txType = dynamicFeeTxType
+		default:
+			return 0, fmt.Errorf("unknown transaction type %q (use legacy, 1 or 2)", explicit)
+		}
+		if txType == dynamicFeeTxType && gasPrice {
+			return 0, fmt.Errorf("type 2 transactions take --max-fee-per-gas, not --gas-price")
+		}
+		if txType != dynamicFeeTxType && feeCaps {
+			return 0, fmt.Errorf("--max-fee-per-gas and --max-priority-fee-per-gas need a type 2 transaction")
+		}
+		return txType, nil
+	}
+
+	switch {
+	case gasPrice && feeCaps:
+		return 0, fmt.Errorf("use either --gas-price or --max-fee-per-gas and --max-priority-fee-per-gas")
+	case feeCaps:
+		return dynamicFeeTxType, nil
+	case gasPrice || node == nil:
+		return 0, nil
+	}
+	baseFee, err := node.baseFee()
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch base fee: %v", err)
+	}
+	if baseFee != nil {
+		return dynamicFeeTxType, nil
+	}
+	return 0, nil
+}
+
+// defaultFees suggests fee caps for a type 2 transaction from node: its
+// suggested priority fee, and a max fee of twice the latest base fee plus
+// that, which covers six blocks of base fee increases.
+func defaultFees(node *rpcNode) (tip *big.Int, maxFee *big.Int, err error) {
+	baseFee, err := node.baseFee()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch base fee: %v", err)
+	}
+	if baseFee == nil {
+		return nil, nil, fmt.Errorf("%s has no base fee; use --tx-type legacy", node.url)
+	}
+	if tip, err = node.suggestTip(); err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch priority fee: %v", err)
+	}
+	maxFee = new(big.Int).Mul(baseFee, big.NewInt(2))
+	return tip, maxFee.Add(maxFee, tip), nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEvalFeeExpr(t *testing.T) {
+	vars := map[string]*big.Int{
+		"baseFee": big.NewInt(10000000000), // 10 gwei
+		"tip":     big.NewInt(1500000000),  // 1.5 gwei
+	}
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"baseFee", "10000000000"},
+		{"baseFee*3 + 3gwei", "33000000000"},
+		{"baseFee * 1.5", "15000000000"},
+		{"baseFee + tip/2", "10750000000"},
+		{"(baseFee + tip) * 2", "23000000000"},
+		{"baseFee*2 - tip", "18500000000"},
+		{"21000", "21000"},
+		{"0.5gwei", "500000000"},
+		{"tip / 3", "500000000"},
+		{"1wei / 3", "0"},
+	}
+	for _, test := range tests {
+		got, err := evalFeeExpr(test.expr, vars)
+		if err != nil {
+			t.Errorf("%q: %v", test.expr, err)
+		} else if got.String() != test.want {
+			t.Errorf("%q: got %s, want %s", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestEvalFeeExprErrors(t *testing.T) {
+	vars := map[string]*big.Int{"baseFee": big.NewInt(1), "tip": big.NewInt(1)}
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "unexpected end"},
+		{"baseFee +", "unexpected end"},
+		{"gasPrice", "unknown variable"},
+		{"3foo", "invalid amount"},
+		{"baseFee / 0", "division by zero"},
+		{"(baseFee", "missing )"},
+		{"baseFee tip", "unexpected"},
+		{"tip - 2gwei", "negative"},
+		{"baseFee % 2", "unexpected"},
+	}
+	for _, test := range tests {
+		_, err := evalFeeExpr(test.expr, vars)
+		if err == nil {
+			t.Errorf("%q: no error", test.expr)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: got error %q, want %q", test.expr, err, test.err)
+		}
+	}
+}
+
+func TestFeePreset(t *testing.T) {
+	url := fakeNode(t, map[string]interface{}{
+		"eth_getBlockByNumber":     map[string]interface{}{"number": "0x10", "baseFeePerGas": "0x2540be400"},
+		"eth_maxPriorityFeePerGas": "0x3b9aca00",
+	})
+	node, err := dialNode(url, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.close()
+
+	conf := &config{FeePresets: map[string]string{"turbo": "baseFee*3 + tip"}}
+	fee, err := feePreset(conf, "turbo", node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "31000000000"; fee.String() != want {
+		t.Errorf("got %s, want %s", fee, want)
+	}
+	if _, err := feePreset(conf, "slow", node); err == nil || !strings.Contains(err.Error(), "no fee preset") {
+		t.Errorf("missing preset: got %v", err)
+	}
+
+	legacy := fakeNode(t, map[string]interface{}{
+		"eth_getBlockByNumber": map[string]interface{}{"number": "0x10"},
+	})
+	node, err = dialNode(legacy, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.close()
+	if _, err := feePreset(conf, "turbo", node); err == nil || !strings.Contains(err.Error(), "no base fee") {
+		t.Errorf("chain without base fee: got %v", err)
+	}
+}
+
+func TestChooseTxType(t *testing.T) {
+	london, err := dialNode(fakeNode(t, map[string]interface{}{
+		"eth_getBlockByNumber":     map[string]interface{}{"number": "0x10", "baseFeePerGas": "0x2540be400"},
+		"eth_maxPriorityFeePerGas": "0x3b9aca00",
+	}), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer london.close()
+	legacy, err := dialNode(fakeNode(t, map[string]interface{}{
+		"eth_getBlockByNumber": map[string]interface{}{"number": "0x10"},
+	}), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer legacy.close()
+
+	tests := []struct {
+		name     string
+		explicit string
+		gasPrice bool
+		feeCaps  bool
+		node     *rpcNode
+		want     int
+		err      string
+	}{
+		{name: "base fee", node: london, want: dynamicFeeTxType},
+		{name: "no base fee", node: legacy, want: 0},
+		{name: "no node", want: 0},
+		{name: "gas price", gasPrice: true, node: london, want: 0},
+		{name: "fee caps", feeCaps: true, node: legacy, want: dynamicFeeTxType},
+		{name: "forced legacy", explicit: "legacy", node: london, want: 0},
+		{name: "forced type 1", explicit: "1", gasPrice: true, node: london, want: accessListTxType},
+		{name: "forced type 2", explicit: "2", node: legacy, want: dynamicFeeTxType},
+		{name: "unknown type", explicit: "3", err: "unknown transaction type"},
+		{name: "type 2 gas price", explicit: "2", gasPrice: true, err: "not --gas-price"},
+		{name: "legacy fee caps", explicit: "0", feeCaps: true, err: "need a type 2"},
+		{name: "both", gasPrice: true, feeCaps: true, err: "use either"},
+	}
+	for _, test := range tests {
+		got, err := chooseTxType(test.explicit, test.gasPrice, test.feeCaps, test.node)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		} else if got != test.want {
+			t.Errorf("%s: got type %d, want %d", test.name, got, test.want)
+		}
+	}
+
+	tip, maxFee, err := defaultFees(london)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tip.String() != "1000000000" || maxFee.String() != "21000000000" {
+		t.Errorf("default fees: got tip %s and max fee %s", tip, maxFee)
+	}
+	if _, _, err := defaultFees(legacy); err == nil {
+		t.Error("default fees without a base fee: expected an error")
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// hardenedOffset is added to BIP-32 child indexes for hardened derivation.
+const hardenedOffset = 0x80000000
+
+// hdKey is a BIP-32 extended private key.
+type hdKey struct {
+	key   *ecdsa.PrivateKey
+	chain []byte
+}
+
+// mnemonicSeed checks a BIP-39 mnemonic and turns it into a seed.
+func mnemonicSeed(mnemonic string, passphrase string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if err := checkMnemonic(words); err != nil {
+		return nil, err
+	}
+	return pbkdf2.Key([]byte(strings.Join(words, " ")), []byte("mnemonic"+passphrase), 2048, 64, sha512.New), nil
+}
+
+// newMasterKey derives the BIP-32 master key from a seed.
+func newMasterKey(seed []byte) (*hdKey, error) {
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	key, err := crypto.ToECDSA(sum[:32])
+	if err != nil {
+		return nil, err
+	}
+	return &hdKey{key, sum[32:]}, nil
+}
+
+// child derives the child key with the given index, which is hardened if
+// it is at least hardenedOffset.
+func (k *hdKey) child(index uint32) (*hdKey, error) {
+	var data []byte
+	if index >= hardenedOffset {
+		data = append([]byte{0}, math.PaddedBigBytes(k.key.D, 32)...)
+	} else {
+		data = crypto.CompressPubkey(&k.key.PublicKey)
+	}
+	data = append(data, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+	mac := hmac.New(sha512.New, k.chain)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	n := crypto.S256().Params().N
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(n) >= 0 {
+		return nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	d := tweak.Add(tweak, k.key.D)
+	d.Mod(d, n)
+	if d.Sign() == 0 {
+		return nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+
+	key, err := crypto.ToECDSA(math.PaddedBigBytes(d, 32))
+	if err != nil {
+		return nil, err
+	}
+	return &hdKey{key, sum[32:]}, nil
+}
+
+// derive follows a derivation path down from k.
+func (k *hdKey) derive(path accounts.DerivationPath) (*hdKey, error) {
+	var err error
+	for _, index := range path {
+		if k, err = k.child(index); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// hdPublicKey is a BIP-32 extended public key, which can derive only
+// non-hardened children and cannot sign.
+type hdPublicKey struct {
+	key   *ecdsa.PublicKey
+	chain []byte
+}
+
+// base58Alphabet is the Bitcoin base58 alphabet.
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// decodeBase58Check decodes base58 and checks and strips the trailing
+// four-byte double SHA-256 checksum.
+func decodeBase58Check(s string) ([]byte, error) {
+	n := new(big.Int)
+	for _, r := range s {
+		digit := strings.IndexRune(base58Alphabet, r)
+		if digit < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", r)
+		}
+		n.Mul(n, big.NewInt(58))
+		n.Add(n, big.NewInt(int64(digit)))
+	}
+	decoded := n.Bytes()
+	for _, r := range s {
+		if r != '1' {
+			break
+		}
+		decoded = append([]byte{0}, decoded...)
+	}
+
+	if len(decoded) < 4 {
+		return nil, fmt.Errorf("too short")
+	}
+	payload, checksum := decoded[:len(decoded)-4], decoded[len(decoded)-4:]
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	if !hmac.Equal(second[:4], checksum) {
+		return nil, fmt.Errorf("bad checksum")
+	}
+	return payload, nil
+}
+
+// parseXpub decodes a serialized extended public key (xpub...).
+func parseXpub(s string) (*hdPublicKey, error) {
+	payload, err := decodeBase58Check(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) != 78 {
+		return nil, fmt.Errorf("expected 78 bytes, got %d", len(payload))
+	}
+	if payload[45] != 2 && payload[45] != 3 {
+		return nil, fmt.Errorf("not an extended public key")
+	}
+	key, err := crypto.DecompressPubkey(payload[45:])
+	if err != nil {
+		return nil, err
+	}
+	return &hdPublicKey{key, payload[13:45]}, nil
+}
+
+// child derives the non-hardened child public key with the given index.
+func (k *hdPublicKey) child(index uint32) (*hdPublicKey, error) {
+	if index >= hardenedOffset {
+		return nil, fmt.Errorf("cannot derive hardened index %d from a public key", index-hardenedOffset)
+	}
+	data := append(crypto.CompressPubkey(k.key), 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(data[len(data)-4:], index)
+
+	mac := hmac.New(sha512.New, k.chain)
+	mac.Write(data)
+	sum := mac.Sum(nil)
+
+	curve := crypto.S256()
+	if new(big.Int).SetBytes(sum[:32]).Cmp(curve.Params().N) >= 0 {
+		return nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	x, y := curve.ScalarBaseMult(sum[:32])
+	x, y = curve.Add(x, y, k.key.X, k.key.Y)
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return nil, fmt.Errorf("invalid child key at index %d", index)
+	}
+	return &hdPublicKey{&ecdsa.PublicKey{Curve: curve, X: x, Y: y}, sum[32:]}, nil
+}
+
+// parseRelativePath parses a non-hardened path below an extended key,
+// such as "0/5".
+func parseRelativePath(s string) ([]uint32, error) {
+	var path []uint32
+	for _, part := range strings.Split(s, "/") {
+		index, err := strconv.ParseUint(part, 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path component %q", part)
+		}
+		path = append(path, uint32(index))
+	}
+	return path, nil
+}
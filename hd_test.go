@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"strings"
+	"testing"
+)
+
+func TestMnemonicSeed(t *testing.T) {
+	// Vectors from the BIP-39 reference implementation, which uses the
+	// passphrase "TREZOR".
+	tests := []struct {
+		mnemonic string
+		seed     string
+	}{
+		{
+			"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			"0xc55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"0x2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			"letter advice cage absurd amount doctor acoustic avoid letter advice cage above",
+			"0xd71de856f81a8acc65e6fc851a38d4d7ec216fd0796d0a6827a3ad6ed5511a30fa280f12eb2e47ed2ac03b5c462a0358d18d69fe4f985ec81778c1b370b652a8",
+		},
+		{
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+			"0xac27495480225222079d7be181583751e86f571027b0497b5b5d11218e0a8a13332572917f0f8e5a589620c6f15b11c61dee327651a14c34e18231052e48c069",
+		},
+	}
+	for _, test := range tests {
+		seed, err := mnemonicSeed(test.mnemonic, "TREZOR")
+		if err != nil {
+			t.Errorf("%s: %v", test.mnemonic, err)
+			continue
+		}
+		if got := hexutil.Encode(seed); got != test.seed {
+			t.Errorf("%s: got seed %s, want %s", test.mnemonic, got, test.seed)
+		}
+	}
+}
+
+func TestMnemonicAddress(t *testing.T) {
+	// The well-known development mnemonic used by Hardhat and Anvil, with
+	// extra whitespace as a mnemonic file might have.
+	seed, err := mnemonicSeed("test test test test test test\ntest test test test test junk\n", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := newMasterKey(seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := master.derive(accounts.DefaultBaseDerivationPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := crypto.PubkeyToAddress(key.key.PublicKey).Hex(), "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestMnemonicSeedErrors(t *testing.T) {
+	tests := []struct {
+		mnemonic string
+		err      string
+	}{
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", "not 11"},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon", "checksum"},
+		{"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abuot", `word 12 ("abuot")`},
+		{"Abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", `word 1 ("Abandon")`},
+		{"legal winner thank year wave sausage worth useful legal winner thank year", "checksum"},
+		{strings.Repeat("zoo ", 27), "not 27"},
+	}
+	for _, test := range tests {
+		_, err := mnemonicSeed(test.mnemonic, "")
+		if err == nil {
+			t.Errorf("%s: no error", test.mnemonic)
+		} else if !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %q, want %q", test.mnemonic, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// hwCache remembers the addresses derived from hardware wallets, keyed by
+// the device's USB URL and then by path, so that listing them needs no
+// derivation at all. It is never used for signing.
+type hwCache map[string]map[string]common.Address
+
+// defaultHWCache is where derived addresses are kept unless --hw-cache
+// says otherwise.
+func defaultHWCache() string {
+	return filepath.Join(os.Getenv("HOME"), ".ethsign", "hw-accounts.json")
+}
+
+// readHWCache reads the cache at path. A missing file is an empty cache.
+func readHWCache(path string) (hwCache, error) {
+	cache := hwCache{}
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &cache); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+func writeHWCache(path string, cache hwCache) error {
+	out, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(out, '\n'), 0600)
+}
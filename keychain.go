@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// keychainPassphrase looks up a passphrase stored in the OS keychain
+// under SERVICE/ACCOUNT.
+func keychainPassphrase(entry string) (string, error) {
+	parts := strings.SplitN(entry, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", fmt.Errorf("ethsign: --passphrase-keychain must be SERVICE/ACCOUNT")
+	}
+	return readKeychain(parts[0], parts[1])
+}
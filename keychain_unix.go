@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// readKeychain reads a passphrase with the security tool on macOS and
+// secret-tool (libsecret) elsewhere.
+func readKeychain(service, account string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		cmd = exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w")
+	} else {
+		cmd = exec.Command("secret-tool", "lookup", "service", service, "account", account)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("ethsign: failed to read passphrase from keychain: %s", msg)
+		}
+		return "", fmt.Errorf("ethsign: failed to read passphrase from keychain: %v", err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
@@ -0,0 +1,75 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"syscall"
+	"unicode/utf16"
+	"unsafe"
+)
+
+var (
+	advapi32      = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW = advapi32.NewProc("CredReadW")
+	procCredFree  = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric = 1
+	errorNotFound   = syscall.Errno(1168)
+)
+
+// credential is the Windows CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// readKeychain reads a passphrase from the generic Windows Credential
+// Manager entry named SERVICE:ACCOUNT, the name other keyring libraries
+// use. Passphrases stored by cmdkey or the Control Panel are UTF-16 and
+// those stored by other tools usually UTF-8, so a blob containing NUL
+// bytes is taken to be UTF-16.
+func readKeychain(service, account string) (string, error) {
+	target, err := syscall.UTF16PtrFromString(service + ":" + account)
+	if err != nil {
+		return "", fmt.Errorf("ethsign: invalid --passphrase-keychain: %v", err)
+	}
+
+	var cred *credential
+	ok, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if ok == 0 {
+		if err == errorNotFound {
+			return "", fmt.Errorf("ethsign: no Credential Manager entry %s:%s", service, account)
+		}
+		return "", fmt.Errorf("ethsign: failed to read passphrase from Credential Manager: %v", err)
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	blob := make([]byte, cred.CredentialBlobSize)
+	if len(blob) > 0 {
+		copy(blob, unsafe.Slice(cred.CredentialBlob, len(blob)))
+	}
+
+	if len(blob)%2 == 0 && bytes.IndexByte(blob, 0) >= 0 {
+		units := make([]uint16, len(blob)/2)
+		for i := range units {
+			units[i] = uint16(blob[2*i]) | uint16(blob[2*i+1])<<8
+		}
+		return string(utf16.Decode(units)), nil
+	}
+	return string(blob), nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// checkKeyFileName checks that name can be used for a new key file in
+// dir: a plain file name that the keystore will not skip when scanning
+// (it ignores names starting with "." or ending with "~") and that no
+// existing file has.
+func checkKeyFileName(dir string, name string) error {
+	if name != filepath.Base(name) || name == ".." {
+		return fmt.Errorf("ethsign: --keyfile-name must be a file name, not a path")
+	}
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+		return fmt.Errorf("ethsign: --keyfile-name must not start with . or end with ~, or the key store ignores it")
+	}
+	if _, err := os.Lstat(filepath.Join(dir, name)); err == nil {
+		return fmt.Errorf("ethsign: %s already exists", filepath.Join(dir, name))
+	}
+	return nil
+}
+
+// renameKeyFile gives a newly written key file the given name in the
+// same directory, without replacing a file that already has it.
+func renameKeyFile(path string, name string) (string, error) {
+	renamed := filepath.Join(filepath.Dir(path), name)
+	if err := os.Link(path, renamed); err != nil {
+		return "", err
+	}
+	return renamed, os.Remove(path)
+}
+
+// pbkdf2Iterations is the PBKDF2 iteration count of key files written
+// with --kdf pbkdf2, the same as other tools that write them.
+const pbkdf2Iterations = 262144
+
+// writePBKDF2KeyFile encrypts key with the passphrase into a version 3
+// key file in dir, using PBKDF2-HMAC-SHA256 instead of scrypt so that
+// older tools can read it, and returns its path. The file is named as the
+// key store names its own.
+func writePBKDF2KeyFile(dir string, key *ecdsa.PrivateKey, passphrase string, iterations int) (string, error) {
+	random := make([]byte, 32+aes.BlockSize+16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	salt, iv, id := random[:32], random[32:32+aes.BlockSize], random[32+aes.BlockSize:]
+	id[6] = id[6]&0x0f | 0x40 // version 4
+	id[8] = id[8]&0x3f | 0x80 // RFC 4122 variant
+
+	derived := pbkdf2.Key([]byte(passphrase), salt, iterations, 32, sha256.New)
+	block, err := aes.NewCipher(derived[:16])
+	if err != nil {
+		return "", err
+	}
+	plaintext := math.PaddedBigBytes(key.D, 32)
+	ciphertext := make([]byte, len(plaintext))
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, plaintext)
+	mac := crypto.Keccak256(derived[16:32], ciphertext)
+
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	keyfile := map[string]interface{}{
+		"address": hex.EncodeToString(address[:]),
+		"crypto": map[string]interface{}{
+			"cipher":       "aes-128-ctr",
+			"ciphertext":   hex.EncodeToString(ciphertext),
+			"cipherparams": map[string]string{"iv": hex.EncodeToString(iv)},
+			"kdf":          "pbkdf2",
+			"kdfparams": map[string]interface{}{
+				"c":     iterations,
+				"dklen": 32,
+				"prf":   "hmac-sha256",
+				"salt":  hex.EncodeToString(salt),
+			},
+			"mac": hex.EncodeToString(mac),
+		},
+		"id":      fmt.Sprintf("%x-%x-%x-%x-%x", id[:4], id[4:6], id[6:8], id[8:10], id[10:]),
+		"version": 3,
+	}
+	out, err := json.Marshal(keyfile)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	name := fmt.Sprintf("UTC--%s--%s", now.Format("2006-01-02T15-04-05.000000000Z"), hex.EncodeToString(address[:]))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(out); err != nil {
+		f.Close()
+		return "", err
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestKeyFileKDFs writes a key file with each KDF gen-key --import can
+// use and checks that the key store decrypts it to the same key.
+func TestKeyFileKDFs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethsign-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := crypto.PubkeyToAddress(key.PublicKey)
+
+	tests := []struct {
+		kdf   string
+		write func(dir string) (string, error)
+	}{
+		{"scrypt", func(dir string) (string, error) {
+			acct, err := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP).ImportECDSA(key, "secret")
+			return acct.URL.Path, err
+		}},
+		{"pbkdf2", func(dir string) (string, error) {
+			return writePBKDF2KeyFile(dir, key, "secret", 1024)
+		}},
+	}
+	for _, test := range tests {
+		path, err := test.write(filepath.Join(dir, test.kdf))
+		if err != nil {
+			t.Fatalf("%s: %v", test.kdf, err)
+		}
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var header struct {
+			Crypto struct {
+				KDF string `json:"kdf"`
+			} `json:"crypto"`
+		}
+		if err := json.Unmarshal(contents, &header); err != nil {
+			t.Fatalf("%s: %v", test.kdf, err)
+		}
+		if header.Crypto.KDF != test.kdf {
+			t.Errorf("%s: key file has kdf %q", test.kdf, header.Crypto.KDF)
+		}
+		if !strings.HasSuffix(filepath.Base(path), strings.ToLower(address.Hex()[2:])) {
+			t.Errorf("%s: key file name %s does not end with the address", test.kdf, filepath.Base(path))
+		}
+
+		decrypted, err := keystore.DecryptKey(contents, "secret")
+		if err != nil {
+			t.Errorf("%s: %v", test.kdf, err)
+			continue
+		}
+		if decrypted.Address != address || decrypted.PrivateKey.D.Cmp(key.D) != 0 {
+			t.Errorf("%s: decrypted a different key", test.kdf)
+		}
+		if _, err := keystore.DecryptKey(contents, "wrong"); err == nil {
+			t.Errorf("%s: decrypted with the wrong passphrase", test.kdf)
+		}
+	}
+
+	// The key store finds the PBKDF2 key file like its own.
+	ks := keystore.NewKeyStore(filepath.Join(dir, "pbkdf2"), keystore.LightScryptN, keystore.LightScryptP)
+	if !ks.HasAddress(address) {
+		t.Errorf("key store does not list the PBKDF2 key file")
+	}
+}
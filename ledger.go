@@ -0,0 +1,133 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts"
+
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/karalabe/hid"
+)
+
+// ledgerError explains why deriving an address on a Ledger failed. The
+// driver drops the device's status word, so when it reports the Ethereum
+// app offline the Ledger is asked again directly to tell a locked device
+// from one that has not opened the app.
+func ledgerError(wallet accounts.Wallet, err error) error {
+	status, _ := wallet.Status()
+	switch {
+	case strings.Contains(status, "browser mode"):
+		return fmt.Errorf("ethsign: Ledger's Ethereum app has browser support on; turn it off in the app's settings")
+	case strings.Contains(status, "offline"):
+		wallet.Close()
+		if sw, err := ledgerStatusWord(wallet.URL().Path); err == nil {
+			if err := ledgerStatusError(sw); err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("ethsign: Ledger is locked or the Ethereum app is not open; enter your PIN and open the Ethereum app")
+	}
+	return fmt.Errorf("ethsign: couldn't use Ledger: %v", err)
+}
+
+// ledgerStatusError explains the status words a Ledger answers with when
+// the Ethereum app cannot be used, and returns nil for any other.
+func ledgerStatusError(sw uint16) error {
+	switch sw {
+	case 0x6982, 0x6b0c, 0x5515:
+		return fmt.Errorf("ethsign: Ledger is locked; enter your PIN and open the Ethereum app")
+	case 0x6d00, 0x6e00, 0x6e01, 0x6511:
+		return fmt.Errorf("ethsign: Ledger's Ethereum app is not open; open it on the device")
+	}
+	return nil
+}
+
+// ledgerTimeout bounds how long ledgerStatusWord waits for the device.
+const ledgerTimeout = 2 * time.Second
+
+// openLedger opens the Ledger at the HID path for talking to it directly.
+// The wallet driving it must be closed.
+func openLedger(path string) (*hid.Device, error) {
+	for _, x := range hid.Enumerate(0x2c97, 0) {
+		if x.Path == path {
+			return x.Open()
+		}
+	}
+	return nil, fmt.Errorf("Ledger at %s not found", path)
+}
+
+// ledgerExchange sends one APDU to the Ethereum app, with class E0, and
+// returns its reply and status word, framed as the usbwallet driver
+// frames them: 64-byte packets on channel 0x0101 with tag 0x05 and a
+// sequence number, the first of which starts with the length.
+func ledgerExchange(device io.ReadWriter, ins, p1, p2 byte, data []byte) ([]byte, uint16, error) {
+	apdu := make([]byte, 2, 7+len(data))
+	binary.BigEndian.PutUint16(apdu, uint16(5+len(data)))
+	apdu = append(apdu, 0xe0, ins, p1, p2, byte(len(data)))
+	apdu = append(apdu, data...)
+
+	for seq := 0; len(apdu) > 0; seq++ {
+		packet := make([]byte, 64)
+		copy(packet, []byte{0x01, 0x01, 0x05})
+		binary.BigEndian.PutUint16(packet[3:], uint16(seq))
+		n := copy(packet[5:], apdu)
+		apdu = apdu[n:]
+		if _, err := device.Write(packet); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var reply []byte
+	length := -1
+	packet := make([]byte, 64)
+	for seq := 0; length < 0 || len(reply) < length; seq++ {
+		if _, err := io.ReadFull(device, packet); err != nil {
+			return nil, 0, err
+		}
+		if packet[0] != 0x01 || packet[1] != 0x01 || packet[2] != 0x05 || int(binary.BigEndian.Uint16(packet[3:5])) != seq {
+			return nil, 0, fmt.Errorf("invalid reply from Ledger")
+		}
+		payload := packet[5:]
+		if seq == 0 {
+			length = int(binary.BigEndian.Uint16(payload))
+			payload = payload[2:]
+		}
+		reply = append(reply, payload...)
+	}
+	if length < 2 {
+		return nil, 0, fmt.Errorf("invalid reply from Ledger")
+	}
+	reply = reply[:length]
+	return reply[:length-2], binary.BigEndian.Uint16(reply[length-2:]), nil
+}
+
+// ledgerStatusWord opens the Ledger at the HID path and returns the status
+// word of its answer to the Ethereum app's get-configuration command. The
+// wallet must be closed.
+func ledgerStatusWord(path string) (uint16, error) {
+	device, err := openLedger(path)
+	if err != nil {
+		return 0, err
+	}
+
+	type result struct {
+		sw  uint16
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		defer device.Close()
+		_, sw, err := ledgerExchange(device, 0x06, 0x00, 0x00, nil)
+		done <- result{sw, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.sw, r.err
+	case <-time.After(ledgerTimeout):
+		return 0, fmt.Errorf("Ledger did not answer")
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Instructions of the Ledger Ethereum app for EIP-712.
+const (
+	ledgerSignEIP712       = 0x0c
+	ledgerStructDefinition = 0x1a
+	ledgerStructValue      = 0x1c
+)
+
+// ledgerAPDU is a command for the Ledger Ethereum app.
+type ledgerAPDU struct {
+	ins, p1, p2 byte
+	data        []byte
+}
+
+// ledgerDomain is the EIP712Domain struct typed data is signed in: its
+// fields, which differ between domains, and their values.
+type ledgerDomain struct {
+	fields  []schemaField
+	members map[string]interface{}
+}
+
+// newLedgerDomain is the domain with a name, version, chain ID and
+// verifying contract that domainSeparator hashes.
+func newLedgerDomain(name string, version string, chainID *big.Int, verifyingContract common.Address) ledgerDomain {
+	return ledgerDomain{
+		fields: []schemaField{{"name", "string"}, {"version", "string"}, {"chainId", "uint256"}, {"verifyingContract", "address"}},
+		members: map[string]interface{}{
+			"name":              name,
+			"version":           version,
+			"chainId":           chainID.String(),
+			"verifyingContract": verifyingContract.Hex(),
+		},
+	}
+}
+
+// ledgerTypedData lists the APDUs that send a schema's types and values
+// to a Ledger, which then shows every field for the user to check before
+// signing. The domain and its struct go first, then the signed struct.
+func ledgerTypedData(sch *schema, members map[string]interface{}, domain ledgerDomain) ([]ledgerAPDU, error) {
+	domainSchema := &schema{name: "EIP712Domain", structs: map[string][]schemaField{"EIP712Domain": domain.fields}}
+	domainMembers := domain.members
+
+	var apdus []ledgerAPDU
+	for _, s := range []*schema{domainSchema, sch} {
+		var names []string
+		for name := range s.structs {
+			if name != s.name {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		names = append([]string{s.name}, names...)
+		for _, name := range names {
+			apdus = append(apdus, ledgerAPDU{ledgerStructDefinition, 0x00, 0x00, []byte(name)})
+			for _, f := range s.structs[name] {
+				def, err := ledgerFieldDefinition(f, s)
+				if err != nil {
+					return nil, err
+				}
+				apdus = append(apdus, ledgerAPDU{ledgerStructDefinition, 0x00, 0xff, def})
+			}
+		}
+	}
+
+	for _, root := range []struct {
+		s       *schema
+		members map[string]interface{}
+	}{{domainSchema, domainMembers}, {sch, members}} {
+		apdus = append(apdus, ledgerAPDU{ledgerStructValue, 0x00, 0x00, []byte(root.s.name)})
+		values, err := ledgerStructValues(root.s, root.s.name, root.members)
+		if err != nil {
+			return nil, err
+		}
+		apdus = append(apdus, values...)
+	}
+	return apdus, nil
+}
+
+// ledgerFieldDefinition encodes a struct member for the app: a type
+// byte with flags for arrays and sizes, the struct name of a struct
+// member, the size in bytes, the array levels and the member's name.
+func ledgerFieldDefinition(f schemaField, s *schema) ([]byte, error) {
+	base := baseType(f.typ)
+	var levels []byte
+	for rest := f.typ[len(base):]; rest != ""; {
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("invalid array type %q", f.typ)
+		}
+		if end == 1 {
+			levels = append(levels, 0x00)
+		} else {
+			size, err := strconv.Atoi(rest[1:end])
+			if err != nil || size > 255 {
+				return nil, fmt.Errorf("%s: array is too long for a Ledger", f.name)
+			}
+			levels = append(levels, 0x01, byte(size))
+		}
+		rest = rest[end+1:]
+	}
+
+	var typ byte
+	var size int
+	switch {
+	case hasStruct(s, base):
+		typ = 0
+	case base == "address":
+		typ = 3
+	case base == "bool":
+		typ = 4
+	case base == "string":
+		typ = 5
+	case base == "bytes":
+		typ = 7
+	case strings.HasPrefix(base, "bytes"):
+		typ = 6
+		size, _ = strconv.Atoi(strings.TrimPrefix(base, "bytes"))
+	case strings.HasPrefix(base, "uint"):
+		typ = 2
+		bits, _ := strconv.Atoi(strings.TrimPrefix(base, "uint"))
+		size = bits / 8
+	case strings.HasPrefix(base, "int"):
+		typ = 1
+		bits, _ := strconv.Atoi(strings.TrimPrefix(base, "int"))
+		size = bits / 8
+	default:
+		return nil, fmt.Errorf("unsupported type %q", f.typ)
+	}
+
+	def := []byte{typ}
+	if typ == 0 {
+		def = append(def, byte(len(base)))
+		def = append(def, base...)
+	}
+	if size > 0 {
+		def[0] |= 0x40
+		def = append(def, byte(size))
+	}
+	if levels != nil {
+		def[0] |= 0x80
+		def = append(def, byte(strings.Count(f.typ, "[")))
+		def = append(def, levels...)
+	}
+	def = append(def, byte(len(f.name)))
+	return append(def, f.name...), nil
+}
+
+// hasStruct reports whether a struct of that name is defined, even with
+// no members.
+func hasStruct(s *schema, name string) bool {
+	_, ok := s.structs[name]
+	return ok
+}
+
+// ledgerStructValues lists the APDUs that send a struct's member values,
+// depth first, with the length of each array before its elements.
+func ledgerStructValues(s *schema, name string, members map[string]interface{}) ([]ledgerAPDU, error) {
+	var apdus []ledgerAPDU
+	for _, f := range s.structs[name] {
+		values, err := ledgerMemberValues(s, f.typ, members[f.name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.name, err)
+		}
+		apdus = append(apdus, values...)
+	}
+	return apdus, nil
+}
+
+func ledgerMemberValues(s *schema, typ string, value interface{}) ([]ledgerAPDU, error) {
+	if base, length, err := splitArrayType(typ); err != nil {
+		return nil, err
+	} else if length != 0 {
+		elements, ok := value.([]interface{})
+		if !ok || len(elements) > 255 {
+			return nil, fmt.Errorf("expected an array of at most 255 elements for %s", typ)
+		}
+		apdus := []ledgerAPDU{{ledgerStructValue, 0x00, 0x0f, []byte{byte(len(elements))}}}
+		for _, element := range elements {
+			values, err := ledgerMemberValues(s, base, element)
+			if err != nil {
+				return nil, err
+			}
+			apdus = append(apdus, values...)
+		}
+		return apdus, nil
+	}
+
+	if hasStruct(s, typ) {
+		members, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object for %s", typ)
+		}
+		return ledgerStructValues(s, typ, members)
+	}
+
+	leaf, ok := schemaLeaf(value)
+	if !ok {
+		return nil, fmt.Errorf("expected a value for %s", typ)
+	}
+	raw, err := ledgerValue(typ, leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	// The value is sent after its length, in as many APDUs as it takes,
+	// all but the last marked partial.
+	payload := make([]byte, 2, 2+len(raw))
+	binary.BigEndian.PutUint16(payload, uint16(len(raw)))
+	payload = append(payload, raw...)
+	var apdus []ledgerAPDU
+	for len(payload) > 0 {
+		n := len(payload)
+		if n > 255 {
+			n = 255
+		}
+		apdus = append(apdus, ledgerAPDU{ledgerStructValue, 0x01, 0xff, payload[:n]})
+		payload = payload[n:]
+	}
+	apdus[len(apdus)-1].p1 = 0x00
+	return apdus, nil
+}
+
+// ledgerValue encodes a value of an atomic type as the app reads it:
+// integers big-endian in their size, two's complement if negative,
+// addresses in 20 bytes, booleans in one, and strings and bytes as is.
+func ledgerValue(typ string, value string) ([]byte, error) {
+	switch {
+	case typ == "address":
+		if !common.IsHexAddress(value) {
+			return nil, fmt.Errorf("invalid address %q", value)
+		}
+		return common.HexToAddress(value).Bytes(), nil
+	case typ == "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, err
+		}
+		if b {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case typ == "string":
+		return []byte(value), nil
+	case strings.HasPrefix(typ, "bytes"):
+		return parseHex(value)
+	case strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "int"):
+		bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(typ, "u"), "int"))
+		if err != nil {
+			return nil, err
+		}
+		n, ok := new(big.Int).SetString(value, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", value)
+		}
+		if n.Sign() < 0 {
+			n.Add(n, new(big.Int).Lsh(big.NewInt(1), uint(bits)))
+		}
+		out := make([]byte, bits/8)
+		b := n.Bytes()
+		if len(b) > len(out) {
+			return nil, fmt.Errorf("%s out of range for %s", value, typ)
+		}
+		copy(out[len(out)-len(b):], b)
+		return out, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", typ)
+}
+
+// ledgerPathBytes encodes a derivation path as the app reads it: the
+// number of levels, then each level in four bytes.
+func ledgerPathBytes(path accounts.DerivationPath) []byte {
+	out := []byte{byte(len(path))}
+	for _, level := range path {
+		out = append(out, byte(level>>24), byte(level>>16), byte(level>>8), byte(level))
+	}
+	return out
+}
+
+// ledgerSignTypedData signs EIP-712 typed data on a Ledger. The types and
+// values are sent so that the device shows each field; an Ethereum app
+// too old for that is sent the domain separator and struct hash instead,
+// which it shows for the user to compare, with a warning. The signature
+// ends in a V of 27 or 28.
+func ledgerSignTypedData(device io.ReadWriter, path accounts.DerivationPath, apdus []ledgerAPDU, separator []byte, structHash []byte) ([]byte, error) {
+	clear := true
+	for i, apdu := range apdus {
+		_, sw, err := ledgerExchange(device, apdu.ins, apdu.p1, apdu.p2, apdu.data)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 && (sw == 0x6d00 || sw == 0x6e00) {
+			clear = false
+			break
+		}
+		if sw != 0x9000 {
+			return nil, fmt.Errorf("ethsign: Ledger refused the typed data (status %#04x)", sw)
+		}
+	}
+
+	var reply []byte
+	var sw uint16
+	var err error
+	if clear {
+		reply, sw, err = ledgerExchange(device, ledgerSignEIP712, 0x00, 0x01, ledgerPathBytes(path))
+	} else {
+		// The Ledger shows only the two hashes, so they are printed to
+		// check it against, whether or not --verbose was given.
+		fmt.Fprintln(os.Stderr, "Warning: this Ledger's Ethereum app cannot show typed data; check that it shows these hashes")
+		fmt.Fprintf(os.Stderr, "Domain separator: %s\n", hexutil.Encode(separator))
+		fmt.Fprintf(os.Stderr, "Struct hash:      %s\n", hexutil.Encode(structHash))
+		data := append(ledgerPathBytes(path), separator...)
+		reply, sw, err = ledgerExchange(device, ledgerSignEIP712, 0x00, 0x00, append(data, structHash...))
+	}
+	switch {
+	case err != nil:
+		return nil, err
+	case sw == 0x6985:
+		return nil, fmt.Errorf("ethsign: signing was refused on the Ledger")
+	case sw == 0x6d00 || sw == 0x6e00:
+		return nil, fmt.Errorf("ethsign: Ledger's Ethereum app cannot sign typed data; update it")
+	case sw != 0x9000 || len(reply) != 65:
+		return nil, fmt.Errorf("ethsign: Ledger failed to sign (status %#04x)", sw)
+	}
+	// The app answers V, R and S.
+	return append(reply[1:65:65], reply[0]), nil
+}
+
+// signSchemaOnLedger signs typed data with the account at the first of
+// ledgerPaths that derives from. The wallet is closed so that the device
+// can be talked to directly.
+func signSchemaOnLedger(wallet accounts.Wallet, from common.Address, apdus []ledgerAPDU, separator []byte, structHash []byte) ([]byte, error) {
+	var path accounts.DerivationPath
+	for _, pathstr := range ledgerPaths {
+		p, _ := accounts.ParseDerivationPath(pathstr)
+		if acct, err := wallet.Derive(p, false); err == nil && acct.Address == from {
+			path = p
+			break
+		}
+	}
+	if path == nil {
+		return nil, fmt.Errorf("ethsign: %s not found on the Ledger", from.Hex())
+	}
+	wallet.Close()
+
+	device, err := openLedger(wallet.URL().Path)
+	if err != nil {
+		return nil, fmt.Errorf("ethsign: couldn't use Ledger: %v", err)
+	}
+	defer device.Close()
+	return ledgerSignTypedData(device, path, apdus, separator, structHash)
+}
+
+// signTypedDataOnLedger signs typed data on a Ledger, sending it the
+// struct, its domain and their values to show, since the driver cannot
+// sign a bare digest. The signature's V is 0 or 1, as
+// SignHashWithPassphrase makes it, and counts for --rate-limit.
+func signTypedDataOnLedger(wallet accounts.Wallet, from common.Address, sch *schema, members map[string]interface{}, domain ledgerDomain, separator []byte, structHash []byte) ([]byte, error) {
+	apdus, err := ledgerTypedData(sch, members, domain)
+	if err != nil {
+		return nil, fmt.Errorf("ethsign: can't send typed data to a Ledger: %v", err)
+	}
+	signature, err := signSchemaOnLedger(wallet, from, apdus, separator, structHash)
+	if limited, ok := wallet.(*rateLimitedWallet); ok {
+		err = limited.record(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signature[64] -= 27
+	return signature, nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestLedgerStatusError(t *testing.T) {
+	tests := []struct {
+		sw   uint16
+		want string
+	}{
+		{0x6982, "locked"},
+		{0x6b0c, "locked"},
+		{0x5515, "locked"},
+		{0x6d00, "not open"},
+		{0x6e00, "not open"},
+		{0x6e01, "not open"},
+		{0x6511, "not open"},
+		{0x9000, ""},
+		{0x6a80, ""},
+	}
+	for _, test := range tests {
+		err := ledgerStatusError(test.sw)
+		switch {
+		case test.want == "" && err != nil:
+			t.Errorf("%#04x: got %v, want no error", test.sw, err)
+		case test.want != "" && err == nil:
+			t.Errorf("%#04x: got no error, want %q", test.sw, test.want)
+		case test.want != "" && !strings.Contains(err.Error(), test.want):
+			t.Errorf("%#04x: got %v, want %q", test.sw, err, test.want)
+		}
+	}
+}
+
+// fakeLedger records the packets written to it and answers with replies
+// framed as a Ledger frames them.
+type fakeLedger struct {
+	written [][]byte
+	replies bytes.Buffer
+}
+
+func (d *fakeLedger) Write(packet []byte) (int, error) {
+	d.written = append(d.written, append([]byte(nil), packet...))
+	return len(packet), nil
+}
+
+func (d *fakeLedger) Read(packet []byte) (int, error) {
+	return d.replies.Read(packet)
+}
+
+func (d *fakeLedger) reply(data []byte, sw uint16) {
+	payload := make([]byte, 2, 4+len(data))
+	binary.BigEndian.PutUint16(payload, uint16(len(data)+2))
+	payload = append(payload, data...)
+	payload = append(payload, byte(sw>>8), byte(sw))
+	for seq := 0; len(payload) > 0; seq++ {
+		packet := make([]byte, 64)
+		copy(packet, []byte{0x01, 0x01, 0x05})
+		binary.BigEndian.PutUint16(packet[3:], uint16(seq))
+		payload = payload[copy(packet[5:], payload):]
+		d.replies.Write(packet)
+	}
+}
+
+// apdus reassembles the APDUs written to the device.
+func (d *fakeLedger) apdus() [][]byte {
+	var apdus [][]byte
+	var apdu []byte
+	length := 0
+	for _, packet := range d.written {
+		payload := packet[5:]
+		if binary.BigEndian.Uint16(packet[3:5]) == 0 {
+			length = int(binary.BigEndian.Uint16(payload))
+			payload = payload[2:]
+			apdu = nil
+		}
+		apdu = append(apdu, payload...)
+		if len(apdu) >= length {
+			apdus = append(apdus, apdu[:length])
+		}
+	}
+	return apdus
+}
+
+func TestLedgerExchange(t *testing.T) {
+	device := &fakeLedger{}
+	answer := bytes.Repeat([]byte{0xab}, 100)
+	device.reply(answer, 0x9000)
+
+	data := bytes.Repeat([]byte{0xcd}, 70)
+	reply, sw, err := ledgerExchange(device, 0x1c, 0x01, 0xff, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sw != 0x9000 || !bytes.Equal(reply, answer) {
+		t.Errorf("got reply %x with status %#04x", reply, sw)
+	}
+
+	if len(device.written) != 2 {
+		t.Fatalf("got %d packets, want 2", len(device.written))
+	}
+	for seq, packet := range device.written {
+		if len(packet) != 64 || !bytes.Equal(packet[:5], []byte{0x01, 0x01, 0x05, 0x00, byte(seq)}) {
+			t.Errorf("packet %d: got header %x", seq, packet[:5])
+		}
+	}
+	want := append([]byte{0xe0, 0x1c, 0x01, 0xff, 70}, data...)
+	if apdus := device.apdus(); len(apdus) != 1 || !bytes.Equal(apdus[0], want) {
+		t.Errorf("got APDUs %x, want %x", apdus, want)
+	}
+
+	device = &fakeLedger{}
+	device.reply(nil, 0x6985)
+	device.replies.Bytes()[3] = 0x01
+	if _, _, err := ledgerExchange(device, 0x06, 0x00, 0x00, nil); err == nil {
+		t.Error("accepted a reply out of sequence")
+	}
+}
+
+func TestLedgerFieldDefinition(t *testing.T) {
+	s := &schema{name: "Mail", structs: map[string][]schemaField{
+		"Mail":   {{"from", "Person"}, {"cc", "Person[]"}},
+		"Person": {},
+	}}
+	tests := []struct {
+		field schemaField
+		want  string
+	}{
+		{schemaField{"amount", "uint256"}, "4220" + "06" + hex.EncodeToString([]byte("amount"))},
+		{schemaField{"delta", "int8"}, "4101" + "05" + hex.EncodeToString([]byte("delta"))},
+		{schemaField{"to", "address"}, "03" + "02" + hex.EncodeToString([]byte("to"))},
+		{schemaField{"ok", "bool"}, "04" + "02" + hex.EncodeToString([]byte("ok"))},
+		{schemaField{"note", "string"}, "05" + "04" + hex.EncodeToString([]byte("note"))},
+		{schemaField{"salt", "bytes32"}, "4620" + "04" + hex.EncodeToString([]byte("salt"))},
+		{schemaField{"data", "bytes"}, "07" + "04" + hex.EncodeToString([]byte("data"))},
+		{schemaField{"from", "Person"}, "00" + "06" + hex.EncodeToString([]byte("Person")) + "04" + hex.EncodeToString([]byte("from"))},
+		{schemaField{"cc", "Person[]"}, "80" + "06" + hex.EncodeToString([]byte("Person")) + "0100" + "02" + hex.EncodeToString([]byte("cc"))},
+		{schemaField{"grid", "uint16[3][]"}, "c202" + "02" + "0103" + "00" + "04" + hex.EncodeToString([]byte("grid"))},
+	}
+	for _, test := range tests {
+		got, err := ledgerFieldDefinition(test.field, s)
+		if err != nil {
+			t.Errorf("%s %s: %v", test.field.typ, test.field.name, err)
+		} else if hex.EncodeToString(got) != test.want {
+			t.Errorf("%s %s: got %x, want %s", test.field.typ, test.field.name, got, test.want)
+		}
+	}
+}
+
+func TestLedgerValue(t *testing.T) {
+	tests := []struct {
+		typ   string
+		value string
+		want  string
+		err   string
+	}{
+		{typ: "uint16", value: "258", want: "0102"},
+		{typ: "uint256", value: "0x01", want: strings.Repeat("00", 31) + "01"},
+		{typ: "int8", value: "-1", want: "ff"},
+		{typ: "int16", value: "-256", want: "ff00"},
+		{typ: "uint8", value: "256", err: "out of range"},
+		{typ: "bool", value: "true", want: "01"},
+		{typ: "bool", value: "false", want: "00"},
+		{typ: "address", value: "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826", want: "cd2a3d9f938e13cd947ec05abc7fe734df8dd826"},
+		{typ: "address", value: "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD8", err: "invalid address"},
+		{typ: "address", value: "bob.eth", err: "invalid address"},
+		{typ: "string", value: "Hello", want: "48656c6c6f"},
+		{typ: "bytes", value: "0xdead", want: "dead"},
+	}
+	for _, test := range tests {
+		got, err := ledgerValue(test.typ, test.value)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s %s: got error %v, want %q", test.typ, test.value, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s %s: %v", test.typ, test.value, err)
+		} else if hex.EncodeToString(got) != test.want {
+			t.Errorf("%s %s: got %x, want %s", test.typ, test.value, got, test.want)
+		}
+	}
+}
+
+func TestLedgerSignTypedData(t *testing.T) {
+	s := &schema{name: "Mail", structs: map[string][]schemaField{
+		"Mail":   {{"to", "Person"}, {"contents", "string"}},
+		"Person": {{"name", "string"}, {"tags", "uint8[]"}},
+	}}
+	members := map[string]interface{}{
+		"to":       map[string]interface{}{"name": "Bob", "tags": []interface{}{"1", "2"}},
+		"contents": strings.Repeat("x", 300),
+	}
+	domain := newLedgerDomain("Ether Mail", "1", big.NewInt(1), common.HexToAddress("0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"))
+	apdus, err := ledgerTypedData(s, members, domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, apdu := range apdus {
+		got = append(got, hex.EncodeToString([]byte{apdu.ins, apdu.p1, apdu.p2}))
+	}
+	want := []string{
+		// EIP712Domain, its four fields, Mail, its two, Person, its two.
+		"1a0000", "1a00ff", "1a00ff", "1a00ff", "1a00ff",
+		"1a0000", "1a00ff", "1a00ff",
+		"1a0000", "1a00ff", "1a00ff",
+		// The domain's values.
+		"1c0000", "1c00ff", "1c00ff", "1c00ff", "1c00ff",
+		// Mail: to.name, the length of to.tags and its elements, then
+		// contents in two parts.
+		"1c0000", "1c00ff", "1c000f", "1c00ff", "1c00ff", "1c01ff", "1c00ff",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got APDUs\n%s\nwant\n%s", strings.Join(got, " "), strings.Join(want, " "))
+	}
+	if string(apdus[8].data) != "Person" || string(apdus[16].data) != "Mail" {
+		t.Errorf("got struct names %q and %q", apdus[8].data, apdus[16].data)
+	}
+	if !bytes.Equal(apdus[18].data, []byte{2}) {
+		t.Errorf("got array length %x", apdus[18].data)
+	}
+	if contents := append(apdus[21].data, apdus[22].data...); binary.BigEndian.Uint16(contents) != 300 || len(contents) != 302 {
+		t.Errorf("got contents of %d bytes", len(contents))
+	}
+
+	path, _ := accounts.ParseDerivationPath("m/44'/60'/0'/0/0")
+	separator := bytes.Repeat([]byte{0x11}, 32)
+	structHash := bytes.Repeat([]byte{0x22}, 32)
+	vrs := append([]byte{0x1c}, bytes.Repeat([]byte{0x33}, 64)...)
+	wantSig := append(bytes.Repeat([]byte{0x33}, 64), 0x1c)
+
+	device := &fakeLedger{}
+	for range apdus {
+		device.reply(nil, 0x9000)
+	}
+	device.reply(vrs, 0x9000)
+	sig, err := ledgerSignTypedData(device, path, apdus, separator, structHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sig, wantSig) {
+		t.Errorf("got signature %x, want %x", sig, wantSig)
+	}
+	sent := device.apdus()
+	last := sent[len(sent)-1]
+	if len(sent) != len(apdus)+1 || !bytes.Equal(last[:4], []byte{0xe0, 0x0c, 0x00, 0x01}) || !bytes.Equal(last[5:], ledgerPathBytes(path)) {
+		t.Errorf("got %d APDUs ending in %x", len(sent), last)
+	}
+
+	// Firmware without clear signing is sent the hashes.
+	device = &fakeLedger{}
+	device.reply(nil, 0x6d00)
+	device.reply(vrs, 0x9000)
+	sig, err = ledgerSignTypedData(device, path, apdus, separator, structHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sig, wantSig) {
+		t.Errorf("hashes: got signature %x, want %x", sig, wantSig)
+	}
+	sent = device.apdus()
+	wantData := append(append(ledgerPathBytes(path), separator...), structHash...)
+	if last := sent[len(sent)-1]; len(sent) != 2 || !bytes.Equal(last[:4], []byte{0xe0, 0x0c, 0x00, 0x00}) || !bytes.Equal(last[5:], wantData) {
+		t.Errorf("hashes: got APDUs %x", sent)
+	}
+
+	device = &fakeLedger{}
+	for range apdus {
+		device.reply(nil, 0x9000)
+	}
+	device.reply(nil, 0x6985)
+	if _, err := ledgerSignTypedData(device, path, apdus, separator, structHash); err == nil || !strings.Contains(err.Error(), "refused") {
+		t.Errorf("refusal: got %v", err)
+	}
+}
+
+func TestLedgerPermitMessages(t *testing.T) {
+	owner := common.HexToAddress("0x65c2F08FA0f286A48F8772fa63965ef79ae90f8c")
+	spender := common.HexToAddress("0x000000000000000000000000000000000000bEEF")
+	token := common.HexToAddress("0xA0b86991c6218b36c1d19D4a2e9Eb0cE3606eB48")
+	chainID := big.NewInt(1)
+
+	// The domains and structs shown on a Ledger must hash as the ones
+	// permit and permit2 sign.
+	domains := []struct {
+		domain ledgerDomain
+		want   []byte
+	}{
+		{newLedgerDomain("USD Coin", "2", chainID, token), domainSeparator("USD Coin", "2", chainID, token)},
+		{permit2LedgerDomain(chainID, common.HexToAddress(permit2Address)), permit2DomainSeparator(chainID, common.HexToAddress(permit2Address))},
+	}
+	for i, test := range domains {
+		domainSchema := &schema{name: "EIP712Domain", structs: map[string][]schemaField{"EIP712Domain": test.domain.fields}}
+		got, err := domainSchema.hashStruct("EIP712Domain", test.domain.members)
+		if err != nil {
+			t.Errorf("domain %d: %v", i, err)
+		} else if !bytes.Equal(got, test.want) {
+			t.Errorf("domain %d: got %x, want %x", i, got, test.want)
+		}
+	}
+
+	members := map[string]interface{}{
+		"owner": owner.Hex(), "spender": spender.Hex(), "value": "1000000", "nonce": "7", "deadline": "1700000000",
+	}
+	got, err := permitSchema.hashStruct("Permit", members)
+	want := hashStruct(
+		"Permit(address owner,address spender,uint256 value,uint256 nonce,uint256 deadline)",
+		owner, spender, big.NewInt(1000000), big.NewInt(7), big.NewInt(1700000000),
+	)
+	if err != nil {
+		t.Errorf("Permit: %v", err)
+	} else if !bytes.Equal(got, want) {
+		t.Errorf("Permit: got %x, want %x", got, want)
+	}
+
+	tokens := []permit2Token{
+		{token, big.NewInt(1000000), big.NewInt(1800000000), big.NewInt(3)},
+		{spender, big.NewInt(5), big.NewInt(1900000000), big.NewInt(4)},
+	}
+	for _, test := range []struct {
+		typ    string
+		tokens []permit2Token
+	}{
+		{"transfer", tokens[:1]},
+		{"batch-transfer", tokens},
+		{"single", tokens[:1]},
+		{"batch", tokens},
+	} {
+		want, err := permit2StructHash(test.typ, test.tokens, spender, big.NewInt(9), big.NewInt(1700000000))
+		if err != nil {
+			t.Fatalf("%s: %v", test.typ, err)
+		}
+		sch, members := permit2Message(test.typ, test.tokens, spender, big.NewInt(9), big.NewInt(1700000000))
+		got, err := sch.hashStruct(sch.name, members)
+		if err != nil {
+			t.Errorf("%s: %v", test.typ, err)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("%s: got %x, want %x", test.typ, got, want)
+		}
+		if _, err := ledgerTypedData(sch, members, permit2LedgerDomain(chainID, common.HexToAddress(permit2Address))); err != nil {
+			t.Errorf("%s: %v", test.typ, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"encoding/json"
+	"io/ioutil"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// network is an EIP-3085 style network definition, as passed to
+// wallet_addEthereumChain.
+type network struct {
+	ChainID        *hexutil.Big `json:"chainId"`
+	ChainName      string       `json:"chainName"`
+	RPCURLs        []string     `json:"rpcUrls"`
+	NativeCurrency struct {
+		Name     string `json:"name"`
+		Symbol   string `json:"symbol"`
+		Decimals int    `json:"decimals"`
+	} `json:"nativeCurrency"`
+	BlockExplorerURLs []string `json:"blockExplorerUrls"`
+
+	// MinGasPrice is not part of EIP-3085. It sets the chain's protocol
+	// minimum gas price in wei, overriding the built-in table.
+	MinGasPrice *hexutil.Big `json:"minGasPrice,omitempty"`
+}
+
+func readNetworkFile(path string) (*network, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	net := new(network)
+	if err := json.Unmarshal(contents, net); err != nil {
+		return nil, err
+	}
+	return net, nil
+}
+
+// applyNetwork fills in --chain-id and --rpc-url from the network
+// definition unless they were given explicitly, and returns the symbol
+// of the network's native currency.
+func applyNetwork(c *cli.Context, net *network) string {
+	if !c.IsSet("chain-id") && net.ChainID != nil {
+		c.Set("chain-id", net.ChainID.ToInt().String())
+	}
+	if !c.IsSet("rpc-url") && len(net.RPCURLs) > 0 {
+		c.Set("rpc-url", net.RPCURLs[0])
+	}
+	if net.NativeCurrency.Symbol != "" {
+		return net.NativeCurrency.Symbol
+	}
+	return "ether"
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// signedTx is the JSON representation of a signed transaction.
+// Legacy transactions have no type, fee caps or access list. The effective
+// gas price of a type 2 transaction is only known given a base fee.
+type signedTx struct {
+	Type                 *hexutil.Uint64 `json:"type,omitempty"`
+	Hash                 common.Hash     `json:"hash"`
+	From                 common.Address  `json:"from"`
+	To                   *common.Address `json:"to"`
+	Nonce                hexutil.Uint64  `json:"nonce"`
+	GasPrice             *hexutil.Big    `json:"gasPrice,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas,omitempty"`
+	EffectiveGasPrice    *hexutil.Big    `json:"effectiveGasPrice,omitempty"`
+	GasLimit             hexutil.Uint64  `json:"gasLimit"`
+	Value                *hexutil.Big    `json:"value"`
+	Data                 hexutil.Bytes   `json:"data"`
+	AccessList           *accessList     `json:"accessList,omitempty"`
+	ChainID              *hexutil.Big    `json:"chainId"`
+	V                    *hexutil.Big    `json:"v,omitempty"`
+	YParity              *hexutil.Uint64 `json:"yParity,omitempty"`
+	R                    *hexutil.Big    `json:"r"`
+	S                    *hexutil.Big    `json:"s"`
+	Raw                  hexutil.Bytes   `json:"raw"`
+	Size                 hexutil.Uint64  `json:"size"`
+	IntrinsicGas         hexutil.Uint64  `json:"intrinsicGas"`
+	Summary              string          `json:"summary,omitempty"`
+	Memo                 string          `json:"memo,omitempty"`
+}
+
+func newSignedTx(tx *types.Transaction, from common.Address, chainID *big.Int) (*signedTx, error) {
+	raw, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return nil, err
+	}
+	v, r, s := tx.RawSignatureValues()
+	return &signedTx{
+		Hash:         tx.Hash(),
+		From:         from,
+		To:           tx.To(),
+		Nonce:        hexutil.Uint64(tx.Nonce()),
+		GasPrice:     (*hexutil.Big)(tx.GasPrice()),
+		GasLimit:     hexutil.Uint64(tx.Gas()),
+		Value:        (*hexutil.Big)(tx.Value()),
+		Data:         tx.Data(),
+		ChainID:      (*hexutil.Big)(chainID),
+		V:            (*hexutil.Big)(v),
+		R:            (*hexutil.Big)(r),
+		S:            (*hexutil.Big)(s),
+		Raw:          raw,
+		Size:         hexutil.Uint64(len(raw)),
+		IntrinsicGas: hexutil.Uint64(intrinsicGas(tx.Data(), tx.To() == nil)),
+	}, nil
+}
+
+// useYParity replaces V with yParity, the 0 or 1 that V encodes after
+// EIP-155, as newer RPC specs name it. Typed transactions sign with the
+// parity itself.
+func (tx *signedTx) useYParity() {
+	v := new(big.Int).Set(tx.V.ToInt())
+	if tx.Type != nil {
+		// V is already the parity.
+	} else if tx.ChainID != nil && v.Cmp(big.NewInt(35)) >= 0 {
+		v.Sub(v, new(big.Int).Mul(tx.ChainID.ToInt(), big.NewInt(2)))
+		v.Sub(v, big.NewInt(35))
+	} else {
+		v.Sub(v, big.NewInt(27))
+	}
+	parity := hexutil.Uint64(v.Uint64())
+	tx.V, tx.YParity = nil, &parity
+}
+
+// intrinsicGas is the gas a transaction costs before executing anything:
+// 21000, or 53000 to create a contract, plus 4 per zero byte and 16 per
+// non-zero byte of data (EIP-2028).
+func intrinsicGas(data []byte, create bool) uint64 {
+	gas := uint64(21000)
+	if create {
+		gas = 53000
+	}
+	for _, b := range data {
+		if b == 0 {
+			gas += 4
+		} else {
+			gas += 16
+		}
+	}
+	return gas
+}
+
+// verifyEncodedTx decodes a signed transaction and compares every field
+// and the recovered sender against what was meant to be signed,
+// returning a description of each field that differs.
+func verifyEncodedTx(encoded []byte, want *types.Transaction, from common.Address, chainID *big.Int) ([]string, error) {
+	got := new(types.Transaction)
+	if err := rlp.DecodeBytes(encoded, got); err != nil {
+		return nil, err
+	}
+
+	var mismatches []string
+	mismatch := func(field string, want interface{}, got interface{}) {
+		mismatches = append(mismatches, fmt.Sprintf("%s: expected %v, got %v", field, want, got))
+	}
+
+	if got.Nonce() != want.Nonce() {
+		mismatch("nonce", want.Nonce(), got.Nonce())
+	}
+	if (got.To() == nil) != (want.To() == nil) || (got.To() != nil && *got.To() != *want.To()) {
+		mismatch("to", want.To(), got.To())
+	}
+	if got.Value().Cmp(want.Value()) != 0 {
+		mismatch("value", want.Value(), got.Value())
+	}
+	if got.Gas() != want.Gas() {
+		mismatch("gas limit", want.Gas(), got.Gas())
+	}
+	if got.GasPrice().Cmp(want.GasPrice()) != 0 {
+		mismatch("gas price", want.GasPrice(), got.GasPrice())
+	}
+	if !bytes.Equal(got.Data(), want.Data()) {
+		mismatch("data", hexutil.Encode(want.Data()), hexutil.Encode(got.Data()))
+	}
+	if !got.Protected() || got.ChainId().Cmp(chainID) != 0 {
+		mismatch("chain ID", chainID, got.ChainId())
+	}
+
+	sender, err := types.Sender(types.NewEIP155Signer(chainID), got)
+	if err != nil {
+		mismatches = append(mismatches, "from: "+err.Error())
+	} else if sender != from {
+		mismatch("from", from.Hex(), sender.Hex())
+	}
+	return mismatches, nil
+}
+
+// rawTx is a raw signed transaction of any type, decoded, with its
+// recovered sender. Either legacy or typed is set; chainID is nil for a
+// legacy transaction without replay protection.
+type rawTx struct {
+	legacy  *types.Transaction
+	typed   *typedTx
+	from    common.Address
+	to      *common.Address
+	value   *big.Int
+	nonce   uint64
+	chainID *big.Int
+}
+
+// decodeRawTx decodes a raw signed legacy, type 1 or type 2 transaction.
+func decodeRawTx(raw []byte) (*rawTx, error) {
+	if len(raw) > 0 && (raw[0] == accessListTxType || raw[0] == dynamicFeeTxType) {
+		ttx, err := decodeTypedTx(raw)
+		if err != nil {
+			return nil, err
+		}
+		from, err := ttx.sender()
+		if err != nil {
+			return nil, fmt.Errorf("failed to recover sender: %v", err)
+		}
+		return &rawTx{typed: ttx, from: from, to: ttx.To, value: ttx.Value, nonce: ttx.Nonce, chainID: ttx.ChainID}, nil
+	}
+
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(raw, tx); err != nil {
+		return nil, err
+	}
+	var signer types.Signer = types.HomesteadSigner{}
+	var chainID *big.Int
+	if tx.Protected() {
+		chainID = tx.ChainId()
+		signer = types.NewEIP155Signer(chainID)
+	}
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover sender: %v", err)
+	}
+	return &rawTx{legacy: tx, from: from, to: tx.To(), value: tx.Value(), nonce: tx.Nonce(), chainID: chainID}, nil
+}
+
+// txExpectations are the fields check-tx compares a raw transaction
+// against; nil fields, and an empty to, are not checked. To is an
+// address or "create".
+type txExpectations struct {
+	from    *common.Address
+	to      string
+	value   *big.Int
+	nonce   *uint64
+	chainID *big.Int
+}
+
+// check compares the transaction against what --cbor recorded, if given,
+// and the expectations, returning a description of each field that
+// differs.
+func (tx *rawTx) check(recorded *cborTx, expect txExpectations) []string {
+	var mismatches []string
+	mismatch := func(field string, want string, got string) {
+		mismatches = append(mismatches, fmt.Sprintf("%s: expected %s, got %s", field, want, got))
+	}
+	chainID := "none"
+	if tx.chainID != nil {
+		chainID = tx.chainID.String()
+	}
+
+	if recorded != nil {
+		if recorded.from != tx.from {
+			mismatch("--cbor from", recorded.from.Hex(), tx.from.Hex())
+		}
+		if want := fmt.Sprint(recorded.chainID); chainID != want {
+			mismatch("--cbor chain ID", want, chainID)
+		}
+	}
+	if expect.from != nil && *expect.from != tx.from {
+		mismatch("from", expect.from.Hex(), tx.from.Hex())
+	}
+	if expect.to != "" {
+		got := "create"
+		if tx.to != nil {
+			got = tx.to.Hex()
+		}
+		want := expect.to
+		if want != "create" {
+			want = common.HexToAddress(want).Hex()
+		}
+		if got != want {
+			mismatch("to", want, got)
+		}
+	}
+	if expect.value != nil && tx.value.Cmp(expect.value) != 0 {
+		mismatch("value", expect.value.String(), tx.value.String())
+	}
+	if expect.nonce != nil && tx.nonce != *expect.nonce {
+		mismatch("nonce", fmt.Sprint(*expect.nonce), fmt.Sprint(tx.nonce))
+	}
+	if expect.chainID != nil && chainID != expect.chainID.String() {
+		mismatch("chain ID", expect.chainID.String(), chainID)
+	}
+	return mismatches
+}
+
+// describeTx summarizes a transaction in plain English.
+func describeTx(tx *types.Transaction, from common.Address, chainID *big.Int, symbol string) string {
+	value := formatEther(tx.Value()) + " " + symbol
+	gasCost := new(big.Int).Mul(new(big.Int).SetUint64(tx.Gas()), tx.GasPrice())
+
+	var action string
+	if tx.To() == nil {
+		action = fmt.Sprintf("Deploy a contract (%d bytes of code) from %s with %s", len(tx.Data()), from.Hex(), value)
+	} else if len(tx.Data()) > 0 {
+		action = fmt.Sprintf("Call %s from %s with %s and %d bytes of data", tx.To().Hex(), from.Hex(), value, len(tx.Data()))
+	} else {
+		action = fmt.Sprintf("Send %s from %s to %s", value, from.Hex(), tx.To().Hex())
+	}
+
+	return fmt.Sprintf("%s on %s, paying up to %s %s in gas, nonce %d.",
+		action, chainName(chainID), formatEther(gasCost), symbol, tx.Nonce())
+}
+
+// describeFields lists the fields of an unsigned transaction, one per
+// line, for --dry-run. ttx is the typed transaction when tx only stands
+// in for one, and is nil for a legacy transaction.
+func describeFields(tx *types.Transaction, ttx *typedTx, from common.Address, chainID *big.Int, symbol string) string {
+	to := "(contract creation)"
+	if tx.To() != nil {
+		to = tx.To().Hex()
+	}
+	txType := "legacy"
+	fees := fmt.Sprintf("Gas price: %s wei\n", tx.GasPrice())
+	if ttx != nil && ttx.Type == accessListTxType {
+		txType = "1 (EIP-2930)"
+	} else if ttx != nil {
+		txType = "2 (EIP-1559)"
+		fees = fmt.Sprintf("Max fee per gas: %s wei\nMax priority fee per gas: %s wei\n", ttx.GasFeeCap, ttx.GasTipCap)
+	}
+	if ttx != nil {
+		fees += fmt.Sprintf("Access list: %d addresses, %d storage keys\n", len(ttx.AccessList), ttx.AccessList.storageKeyCount())
+	}
+	return fmt.Sprintf("Type: %s\nChain ID: %s (%s)\nFrom: %s\nTo: %s\nNonce: %d\nValue: %s %s\nGas limit: %d\n%sData: %s\n",
+		txType, chainID, chainName(chainID), from.Hex(), to, tx.Nonce(), formatEther(tx.Value()), symbol, tx.Gas(), fees, hexutil.Encode(tx.Data()))
+}
+
+// marshalJSON encodes v as JSON on a single line, or pretty-printed with
+// the given number of spaces per level when indent is positive.
+func marshalJSON(v interface{}, indent int) ([]byte, error) {
+	if indent <= 0 {
+		return json.Marshal(v)
+	}
+	return json.MarshalIndent(v, "", strings.Repeat(" ", indent))
+}
+
+// writeJSON writes v as JSON to the file at path.
+func writeJSON(path string, v interface{}, indent int) error {
+	out, err := marshalJSON(v, indent)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(out, '\n'), 0644)
+}
+
+// writeBinary writes a signed transaction, raw or in hex, to the file
+// at path, readable only by its owner even if the file already existed.
+func writeBinary(path string, data []byte) error {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
+
+// appendAuditLog appends a single line describing a signed transaction
+// to the audit log at path, creating the file if needed. A memo is
+// quoted so that it stays on the line.
+func appendAuditLog(path string, tx *signedTx) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	to := "create"
+	if tx.To != nil {
+		to = tx.To.Hex()
+	}
+	memo := ""
+	if tx.Memo != "" {
+		memo = " memo=" + strconv.Quote(tx.Memo)
+	}
+	_, err = fmt.Fprintf(f, "%s tx hash=%s from=%s to=%s nonce=%d value=%s chain-id=%s%s\n",
+		time.Now().UTC().Format(time.RFC3339), tx.Hash.Hex(), tx.From.Hex(), to,
+		uint64(tx.Nonce), tx.Value.ToInt(), tx.ChainID.ToInt(), memo)
+	return err
+}
+
+// bridgeEnvelope wraps a signed transaction for relayer intake. Without a
+// schema it is {"chainId", "from", "hash", "signedTransaction",
+// "submittedAt"}. A schema file is a JSON template in which every string
+// that is exactly "{{name}}" is replaced by that value: raw, hash, from,
+// to, nonce, chainId or submittedAt.
+func bridgeEnvelope(tx *signedTx, schemaPath string, submittedAt time.Time) (interface{}, error) {
+	var to interface{}
+	if tx.To != nil {
+		to = tx.To
+	}
+	values := map[string]interface{}{
+		"raw":         tx.Raw,
+		"hash":        tx.Hash,
+		"from":        tx.From,
+		"to":          to,
+		"nonce":       uint64(tx.Nonce),
+		"chainId":     tx.ChainID.ToInt(),
+		"submittedAt": submittedAt.UTC().Format(time.RFC3339),
+	}
+
+	if schemaPath == "" {
+		return map[string]interface{}{
+			"chainId":           values["chainId"],
+			"from":              values["from"],
+			"hash":              values["hash"],
+			"signedTransaction": values["raw"],
+			"submittedAt":       values["submittedAt"],
+		}, nil
+	}
+
+	contents, err := ioutil.ReadFile(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	var template interface{}
+	if err := json.Unmarshal(contents, &template); err != nil {
+		return nil, err
+	}
+	return fillTemplate(template, values)
+}
+
+func fillTemplate(template interface{}, values map[string]interface{}) (interface{}, error) {
+	switch t := template.(type) {
+	case string:
+		if strings.HasPrefix(t, "{{") && strings.HasSuffix(t, "}}") {
+			value, ok := values[strings.TrimSpace(t[2:len(t)-2])]
+			if !ok {
+				return nil, fmt.Errorf("unknown placeholder %s", t)
+			}
+			return value, nil
+		}
+		return t, nil
+	case map[string]interface{}:
+		filled := make(map[string]interface{})
+		for k, v := range t {
+			f, err := fillTemplate(v, values)
+			if err != nil {
+				return nil, err
+			}
+			filled[k] = f
+		}
+		return filled, nil
+	case []interface{}:
+		filled := make([]interface{}, len(t))
+		for i, v := range t {
+			f, err := fillTemplate(v, values)
+			if err != nil {
+				return nil, err
+			}
+			filled[i] = f
+		}
+		return filled, nil
+	}
+	return template, nil
+}
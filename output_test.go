@@ -0,0 +1,182 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestBinaryRoundTrip writes signed transactions as --out-binary does
+// and decodes them again.
+func TestBinaryRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethsign-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks := keystore.NewKeyStore(filepath.Join(dir, "keystore"), keystore.LightScryptN, keystore.LightScryptP)
+	acct, err := ks.NewAccount("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	tests := []struct {
+		name    string
+		tx      *types.Transaction
+		chainID *big.Int
+	}{
+		{"transfer", types.NewTransaction(0, to, big.NewInt(1), 21000, big.NewInt(1000000000), nil), big.NewInt(1)},
+		{"call", types.NewTransaction(7, to, big.NewInt(0), 60000, big.NewInt(2), []byte{0xa9, 0x05, 0x9c, 0xbb, 0x00}), big.NewInt(31337)},
+		{"create", types.NewContractCreation(1, big.NewInt(0), 100000, big.NewInt(3), []byte{0x60, 0x00}), big.NewInt(11155111)},
+	}
+	for i, test := range tests {
+		signed, err := ks.SignTxWithPassphrase(acct, "test", test.tx, test.chainID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded, err := rlp.EncodeToBytes(signed)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(dir, test.name+".bin")
+		if i == 0 {
+			// An existing file must not keep looser permissions.
+			if err := ioutil.WriteFile(path, nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := writeBinary(path, encoded); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != 0600 {
+			t.Errorf("%s: file mode %o, want 600", test.name, mode)
+		}
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := new(types.Transaction)
+		if err := rlp.DecodeBytes(contents, decoded); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if decoded.Hash() != signed.Hash() {
+			t.Errorf("%s: decoded hash %s, want %s", test.name, decoded.Hash().Hex(), signed.Hash().Hex())
+		}
+		mismatches, err := verifyEncodedTx(contents, test.tx, acct.Address, test.chainID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range mismatches {
+			t.Errorf("%s: %s", test.name, m)
+		}
+	}
+}
+
+// TestCheckRawTxRoundTrip signs transactions of each type as transaction
+// does, passes them through --out-cbor and decodes them as check-tx does,
+// then signs the typed one for another chain as resign-chain does.
+func TestCheckRawTxRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethsign-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	acct, err := ks.NewAccount("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := ks.Wallets()[0]
+
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	chainID := big.NewInt(1)
+	accesses := accessList{{Address: to, StorageKeys: []common.Hash{common.HexToHash("0x01")}}}
+	tests := []struct {
+		name string
+		tx   *typedTx
+	}{
+		{"legacy", nil},
+		{"type 1", &typedTx{Type: accessListTxType, ChainID: chainID, Nonce: 7, GasPrice: big.NewInt(2), Gas: 30000, To: &to, Value: big.NewInt(5), AccessList: accesses}},
+		{"type 2", &typedTx{Type: dynamicFeeTxType, ChainID: chainID, Nonce: 7, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(3), Gas: 21000, To: &to, Value: big.NewInt(5)}},
+		{"type 2 create", &typedTx{Type: dynamicFeeTxType, ChainID: chainID, Nonce: 7, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(3), Gas: 60000, Value: big.NewInt(5), Data: []byte{0x60, 0x00}}},
+	}
+	for _, test := range tests {
+		var encoded []byte
+		if test.tx == nil {
+			tx := types.NewTransaction(7, to, big.NewInt(5), 21000, big.NewInt(2), nil)
+			_, encoded, err = signLegacyTx(wallet, acct, "test", tx, chainID)
+		} else {
+			_, encoded, err = signTypedTx(wallet, acct, "test", test.tx)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		recorded, err := decodeCBORTx(encodeCBORTx(cborTx{encoded, acct.Address, chainID.Uint64()}))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		decoded, err := decodeRawTx(recorded.raw)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		wantTo := to.Hex()
+		if test.tx != nil && test.tx.To == nil {
+			wantTo = "create"
+		}
+		nonce := uint64(7)
+		expect := txExpectations{from: &acct.Address, to: wantTo, value: big.NewInt(5), nonce: &nonce, chainID: chainID}
+		if mismatches := decoded.check(recorded, expect); len(mismatches) > 0 {
+			t.Errorf("%s: %q", test.name, mismatches)
+		}
+
+		wrongNonce := uint64(8)
+		expect = txExpectations{nonce: &wrongNonce, chainID: big.NewInt(5)}
+		mismatches := decoded.check(nil, expect)
+		if len(mismatches) != 2 || mismatches[0] != "nonce: expected 8, got 7" || mismatches[1] != "chain ID: expected 5, got 1" {
+			t.Errorf("%s: got mismatches %q", test.name, mismatches)
+		}
+
+		if test.tx == nil {
+			continue
+		}
+		resigned := *decoded.typed
+		resigned.ChainID = big.NewInt(11155111)
+		resigned.V, resigned.R, resigned.S = nil, nil, nil
+		_, raw, err := signTypedTx(wallet, acct, "test", &resigned)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mismatches, err := verifyTypedTx(raw, &resigned, acct.Address); err != nil || len(mismatches) > 0 {
+			t.Errorf("%s: re-signed: %v %q", test.name, err, mismatches)
+		}
+		again, err := decodeRawTx(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mismatches := again.check(nil, txExpectations{from: &acct.Address, chainID: resigned.ChainID}); len(mismatches) > 0 {
+			t.Errorf("%s: re-signed: %q", test.name, mismatches)
+		}
+	}
+
+	if _, err := decodeRawTx([]byte{dynamicFeeTxType, 0xc0}); err == nil {
+		t.Error("decoded an empty type 2 transaction")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// encodePacked encodes values like Solidity's abi.encodePacked: every
+// value takes only its own width, without padding, and strings and
+// bytes are copied as they are. Arrays are not supported.
+func encodePacked(types []string, values []string) ([]byte, error) {
+	if len(types) != len(values) {
+		return nil, fmt.Errorf("%d types but %d values", len(types), len(values))
+	}
+
+	var out []byte
+	for i, typ := range types {
+		value := values[i]
+		switch {
+		case strings.HasSuffix(typ, "]"):
+			return nil, fmt.Errorf("array type %q is not supported", typ)
+
+		case typ == "string":
+			out = append(out, value...)
+
+		case typ == "bytes":
+			b, err := parseHex(value)
+			if err != nil {
+				return nil, fmt.Errorf("value %d: %v", i+1, err)
+			}
+			out = append(out, b...)
+
+		default:
+			word, err := encodeSchemaValue(typ, value)
+			if err != nil {
+				return nil, fmt.Errorf("value %d: %v", i+1, err)
+			}
+			switch word := word.(type) {
+			case common.Address:
+				out = append(out, word.Bytes()...)
+			case uint8:
+				out = append(out, word)
+			case []byte:
+				size, _ := strconv.Atoi(strings.TrimPrefix(typ, "bytes"))
+				out = append(out, word[:size]...)
+			case *big.Int:
+				bits, _ := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(typ, "u"), "int"))
+				padded := math.PaddedBigBytes(math.U256(new(big.Int).Set(word)), 32)
+				out = append(out, padded[32-bits/8:]...)
+			}
+		}
+	}
+	return out, nil
+}
+
+// splitValues splits a --values list on commas. Values are trimmed of
+// surrounding spaces, except that a value in double quotes is kept as it
+// is and may contain commas, with "" standing for a quote inside it:
+//
+//   1, "Hello, world", "say ""hi"""
+func splitValues(s string) ([]string, error) {
+	var values []string
+	var value strings.Builder
+	quoted, inQuote, closed := false, false, false
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case inQuote && r == '"' && i+1 < len(runes) && runes[i+1] == '"':
+			value.WriteRune('"')
+			i++
+		case inQuote && r == '"':
+			inQuote, closed = false, true
+		case inQuote:
+			value.WriteRune(r)
+		case r == ',':
+			values = append(values, finishValue(value.String(), quoted))
+			value.Reset()
+			quoted, closed = false, false
+		case closed:
+			if r != ' ' && r != '\t' {
+				return nil, fmt.Errorf("value %d: unexpected %q after closing quote", len(values)+1, r)
+			}
+		case r == '"' && strings.TrimSpace(value.String()) == "":
+			value.Reset()
+			quoted, inQuote = true, true
+		default:
+			value.WriteRune(r)
+		}
+	}
+	if inQuote {
+		return nil, fmt.Errorf("value %d: unterminated quote", len(values)+1)
+	}
+	return append(values, finishValue(value.String(), quoted)), nil
+}
+
+func finishValue(value string, quoted bool) string {
+	if quoted {
+		return value
+	}
+	return strings.TrimSpace(value)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodePacked(t *testing.T) {
+	tests := []struct {
+		types  string
+		values []string
+		want   string
+	}{
+		// The example in the Solidity documentation.
+		{"int16,bytes1,uint16,string", []string{"-1", "0x42", "3", "Hello, world!"}, "0xffff42000348656c6c6f2c20776f726c6421"},
+		{"address,uint256", []string{"0x5B38Da6a701c568545dCfcB03FcB875f56beddC4", "1"},
+			"0x5b38da6a701c568545dcfcb03fcb875f56beddc40000000000000000000000000000000000000000000000000000000000000001"},
+		{"bool,bool", []string{"true", "false"}, "0x0100"},
+		{"uint8,int8,uint32", []string{"255", "-128", "0x0a0b0c0d"}, "0xff800a0b0c0d"},
+		{"bytes,string,bytes32", []string{"0x1234", "", "0x01"}, "0x12340100000000000000000000000000000000000000000000000000000000000000"},
+		{"bytes4,int256", []string{"0xa9059cbb", "-2"}, "0xa9059cbbfffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffe"},
+		// Packed encoding is ambiguous: these two pack to the same bytes.
+		{"string,string", []string{"ab", "c"}, "0x616263"},
+		{"string,string", []string{"a", "bc"}, "0x616263"},
+	}
+	for _, test := range tests {
+		got, err := encodePacked(strings.Split(test.types, ","), test.values)
+		if err != nil {
+			t.Errorf("%s %q: %v", test.types, test.values, err)
+			continue
+		}
+		if hexutil.Encode(got) != test.want {
+			t.Errorf("%s %q: got %s, want %s", test.types, test.values, hexutil.Encode(got), test.want)
+		}
+	}
+}
+
+func TestEncodePackedErrors(t *testing.T) {
+	tests := []struct {
+		types  string
+		values []string
+	}{
+		{"uint256[]", []string{"1"}},
+		{"uint8", []string{"256"}},
+		{"int8", []string{"128"}},
+		{"bytes2", []string{"0x123456"}},
+		{"address", []string{"0x1234"}},
+		{"uint256,uint256", []string{"1"}},
+		{"uint7", []string{"1"}},
+	}
+	for _, test := range tests {
+		if _, err := encodePacked(strings.Split(test.types, ","), test.values); err == nil {
+			t.Errorf("%s %q: expected an error", test.types, test.values)
+		}
+	}
+}
+
+func TestSplitValues(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"1,2", []string{"1", "2"}},
+		{"1, 2 ,  3", []string{"1", "2", "3"}},
+		{`"Hello, world", x`, []string{"Hello, world", "x"}},
+		{`" padded " ,y`, []string{" padded ", "y"}},
+		{`"say ""hi"""`, []string{`say "hi"`}},
+		{`a"b`, []string{`a"b`}},
+		{`"",`, []string{"", ""}},
+		{"", []string{""}},
+	}
+	for _, test := range tests {
+		got, err := splitValues(test.in)
+		if err != nil {
+			t.Errorf("%q: %v", test.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: got %q, want %q", test.in, got, test.want)
+		}
+	}
+
+	for _, in := range []string{`"unterminated`, `"a"b`, `1, "a" "b"`} {
+		if _, err := splitValues(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
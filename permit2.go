@@ -0,0 +1,137 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"fmt"
+	"math/big"
+)
+
+// permit2Address is where Uniswap's Permit2 is deployed on every chain.
+const permit2Address = "0x000000000022D473030F116dDEE9F6B43aC78BA3"
+
+const (
+	tokenPermissionsType = "TokenPermissions(address token,uint256 amount)"
+	permitDetailsType    = "PermitDetails(address token,uint160 amount,uint48 expiration,uint48 nonce)"
+)
+
+// permit2Types are the Permit2 structs that can be signed, by --type:
+// transfer and batch-transfer for SignatureTransfer, single and batch for
+// AllowanceTransfer.
+var permit2Types = map[string]string{
+	"transfer":       "PermitTransferFrom(TokenPermissions permitted,address spender,uint256 nonce,uint256 deadline)" + tokenPermissionsType,
+	"batch-transfer": "PermitBatchTransferFrom(TokenPermissions[] permitted,address spender,uint256 nonce,uint256 deadline)" + tokenPermissionsType,
+	"single":         "PermitSingle(PermitDetails details,address spender,uint256 sigDeadline)" + permitDetailsType,
+	"batch":          "PermitBatch(PermitDetails[] details,address spender,uint256 sigDeadline)" + permitDetailsType,
+}
+
+// permit2Token is one token in a Permit2 permit. Expiration and nonce are
+// only used by the AllowanceTransfer types.
+type permit2Token struct {
+	token      common.Address
+	amount     *big.Int
+	expiration *big.Int
+	nonce      *big.Int
+}
+
+// permit2DomainSeparator hashes the Permit2 domain, which has a name but
+// no version.
+func permit2DomainSeparator(chainID *big.Int, permit2 common.Address) []byte {
+	return hashStruct(
+		"EIP712Domain(string name,uint256 chainId,address verifyingContract)",
+		crypto.Keccak256([]byte("Permit2")),
+		chainID,
+		permit2,
+	)
+}
+
+// permit2StructHash computes the struct hash of a Permit2 permit of the
+// given type. The nonce is only used by the SignatureTransfer types, whose
+// nonces are per permit rather than per token.
+func permit2StructHash(typ string, tokens []permit2Token, spender common.Address, nonce *big.Int, deadline *big.Int) ([]byte, error) {
+	typeString, ok := permit2Types[typ]
+	if !ok {
+		return nil, fmt.Errorf("ethsign: unknown Permit2 type %q (want transfer, batch-transfer, single or batch)", typ)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("ethsign: need at least one token")
+	}
+	if (typ == "transfer" || typ == "single") && len(tokens) != 1 {
+		return nil, fmt.Errorf("ethsign: --type %s takes exactly one token", typ)
+	}
+
+	var hashes []byte
+	for _, t := range tokens {
+		if typ == "transfer" || typ == "batch-transfer" {
+			hashes = append(hashes, hashStruct(tokenPermissionsType, t.token, t.amount)...)
+			continue
+		}
+		if t.amount.BitLen() > 160 || t.expiration.BitLen() > 48 || t.nonce.BitLen() > 48 {
+			return nil, fmt.Errorf("ethsign: amount must fit in uint160, expiration and nonce in uint48")
+		}
+		hashes = append(hashes, hashStruct(permitDetailsType, t.token, t.amount, t.expiration, t.nonce)...)
+	}
+
+	members := hashes
+	if typ == "batch-transfer" || typ == "batch" {
+		members = crypto.Keccak256(hashes)
+	}
+
+	if typ == "transfer" || typ == "batch-transfer" {
+		return hashStruct(typeString, members, spender, nonce, deadline), nil
+	}
+	return hashStruct(typeString, members, spender, deadline), nil
+}
+
+// permit2LedgerDomain is the domain permit2DomainSeparator hashes, for
+// showing it on a Ledger.
+func permit2LedgerDomain(chainID *big.Int, permit2 common.Address) ledgerDomain {
+	return ledgerDomain{
+		fields: []schemaField{{"name", "string"}, {"chainId", "uint256"}, {"verifyingContract", "address"}},
+		members: map[string]interface{}{
+			"name":              "Permit2",
+			"chainId":           chainID.String(),
+			"verifyingContract": permit2.Hex(),
+		},
+	}
+}
+
+// permit2Message gives a Permit2 permit of a type permit2StructHash
+// accepts as a schema and its member values, for showing it on a Ledger.
+func permit2Message(typ string, tokens []permit2Token, spender common.Address, nonce *big.Int, deadline *big.Int) (*schema, map[string]interface{}) {
+	var permissions []interface{}
+	for _, t := range tokens {
+		p := map[string]interface{}{"token": t.token.Hex(), "amount": t.amount.String()}
+		if typ == "single" || typ == "batch" {
+			p["expiration"], p["nonce"] = t.expiration.String(), t.nonce.String()
+		}
+		permissions = append(permissions, p)
+	}
+
+	switch typ {
+	case "transfer", "batch-transfer":
+		name, permitted := "PermitTransferFrom", "TokenPermissions"
+		var members interface{} = permissions[0]
+		if typ == "batch-transfer" {
+			name, permitted, members = "PermitBatchTransferFrom", "TokenPermissions[]", permissions
+		}
+		return &schema{name: name, structs: map[string][]schemaField{
+			name:               {{"permitted", permitted}, {"spender", "address"}, {"nonce", "uint256"}, {"deadline", "uint256"}},
+			"TokenPermissions": {{"token", "address"}, {"amount", "uint256"}},
+		}}, map[string]interface{}{
+			"permitted": members, "spender": spender.Hex(), "nonce": nonce.String(), "deadline": deadline.String(),
+		}
+	}
+	name, details := "PermitSingle", "PermitDetails"
+	var members interface{} = permissions[0]
+	if typ == "batch" {
+		name, details, members = "PermitBatch", "PermitDetails[]", permissions
+	}
+	return &schema{name: name, structs: map[string][]schemaField{
+		name:            {{"details", details}, {"spender", "address"}, {"sigDeadline", "uint256"}},
+		"PermitDetails": {{"token", "address"}, {"amount", "uint160"}, {"expiration", "uint48"}, {"nonce", "uint48"}},
+	}}, map[string]interface{}{
+		"details": members, "spender": spender.Hex(), "sigDeadline": deadline.String(),
+	}
+}
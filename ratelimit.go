@@ -0,0 +1,155 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rateLimit allows at most max signatures per account in any window.
+type rateLimit struct {
+	max    int
+	window time.Duration
+}
+
+// parseRateLimit parses a limit such as "10/1h" or "3/30m".
+func parseRateLimit(s string) (*rateLimit, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected N/duration, e.g. 10/1h")
+	}
+	max, err := strconv.Atoi(parts[0])
+	if err != nil || max <= 0 {
+		return nil, fmt.Errorf("invalid count %q", parts[0])
+	}
+	window, err := time.ParseDuration(parts[1])
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("invalid window %q", parts[1])
+	}
+	return &rateLimit{max, window}, nil
+}
+
+// defaultRateLimitState is where signing times are kept unless
+// --rate-limit-state says otherwise.
+func defaultRateLimitState() string {
+	return filepath.Join(os.Getenv("HOME"), ".ethsign", "rate-limit.json")
+}
+
+// readRateLimitState reads the state file at path, which maps addresses
+// to the Unix times of their recent signatures. A missing file is an
+// empty state.
+func readRateLimitState(path string) (map[common.Address][]int64, error) {
+	state := map[common.Address][]int64{}
+	contents, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &state); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return state, nil
+}
+
+// recentSignatures returns the times in state of the account's signatures
+// that are still within the window.
+func recentSignatures(state map[common.Address][]int64, limit *rateLimit, account common.Address, now time.Time) []int64 {
+	var recent []int64
+	for _, t := range state[account] {
+		if now.Sub(time.Unix(t, 0)) < limit.window {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// checkRateLimit refuses if the account has already signed limit.max
+// times within the window, according to the state file at path.
+func checkRateLimit(path string, limit *rateLimit, account common.Address) error {
+	state, err := readRateLimitState(path)
+	if err != nil {
+		return err
+	}
+	recent := recentSignatures(state, limit, account, time.Now())
+	if len(recent) >= limit.max {
+		next := time.Unix(recent[len(recent)-limit.max], 0).Add(limit.window)
+		return fmt.Errorf("ethsign: %s has signed %d times in the last %s; rate limit allows more after %s",
+			account.Hex(), len(recent), limit.window, next.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// recordRateLimit adds a signature by the account to the state file at
+// path, dropping the account's signatures that have left the window.
+func recordRateLimit(path string, limit *rateLimit, account common.Address) error {
+	state, err := readRateLimitState(path)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	state[account] = append(recentSignatures(state, limit, account, now), now.Unix())
+
+	out, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, out, 0600)
+}
+
+// rateLimitedWallet records a signature for --rate-limit once one of its
+// signing methods succeeds, so that a wrong passphrase, a refusal on the
+// device or a failed signing does not use up the limit. Signing more
+// than once, as message --self-check does, counts once.
+type rateLimitedWallet struct {
+	accounts.Wallet
+	state    string
+	limit    *rateLimit
+	account  common.Address
+	recorded bool
+}
+
+func (w *rateLimitedWallet) record(err error) error {
+	if err != nil || w.recorded {
+		return err
+	}
+	if err := recordRateLimit(w.state, w.limit, w.account); err != nil {
+		return fmt.Errorf("failed to record signature for --rate-limit: %v", err)
+	}
+	w.recorded = true
+	return nil
+}
+
+func (w *rateLimitedWallet) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	sig, err := w.Wallet.SignHash(account, hash)
+	return sig, w.record(err)
+}
+
+func (w *rateLimitedWallet) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	sig, err := w.Wallet.SignHashWithPassphrase(account, passphrase, hash)
+	return sig, w.record(err)
+}
+
+func (w *rateLimitedWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signed, err := w.Wallet.SignTx(account, tx, chainID)
+	return signed, w.record(err)
+}
+
+func (w *rateLimitedWallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signed, err := w.Wallet.SignTxWithPassphrase(account, passphrase, tx, chainID)
+	return signed, w.record(err)
+}
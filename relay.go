@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// flashbotsRelay is the default Flashbots relay endpoint.
+const flashbotsRelay = "https://relay.flashbots.net"
+
+// relay submits transactions privately to a Flashbots-style relay. Each
+// request is authenticated with the X-Flashbots-Signature header, which
+// signs the request body with authKey. The key only identifies the
+// sender to the relay and needs no funds.
+type relay struct {
+	url     string
+	authKey *ecdsa.PrivateKey
+	client  *http.Client
+}
+
+func newRelay(url string, authKey *ecdsa.PrivateKey, timeout time.Duration) *relay {
+	return &relay{url, authKey, &http.Client{Timeout: timeout}}
+}
+
+// sendPrivateTransaction submits tx with eth_sendPrivateTransaction and
+// returns the relay's result.
+func (r *relay) sendPrivateTransaction(tx *types.Transaction) (string, error) {
+	encoded, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(rpcRequest{"2.0", 1, "eth_sendPrivateTransaction", []interface{}{
+		map[string]interface{}{"tx": hexutil.Bytes(encoded)},
+	}})
+	if err != nil {
+		return "", err
+	}
+
+	// The header signs the hex string of the body's hash as a message.
+	digest := hexutil.Encode(crypto.Keccak256(body))
+	sig, err := crypto.Sign(signHash([]byte(digest)), r.authKey)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("POST", r.url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Flashbots-Signature", crypto.PubkeyToAddress(r.authKey.PublicKey).Hex()+":"+hexutil.Encode(sig))
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+	if result.Error != nil {
+		return "", fmt.Errorf("%s (code %d)", result.Error.Message, result.Error.Code)
+	}
+	return string(result.Result), nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts"
+
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// stdin is shared by everything that reads lines from standard input, so
+// that a passphrase or confirmation read during a repl session does not
+// swallow the commands buffered after it.
+var stdin = bufio.NewReader(os.Stdin)
+
+// walletCache keeps opened wallets for the rest of a repl session, keyed
+// by the key stores and whether USB wallets were requested. It is nil
+// outside of a session.
+var walletCache map[string][]accounts.Wallet
+
+// splitWords splits a repl line into arguments on whitespace. Single or
+// double quotes group words containing spaces.
+func splitWords(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			word.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("ethsign: unterminated quote")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// globalArgs gives the global flags that were set, for passing on to the
+// commands a session runs.
+func globalArgs(c *cli.Context) []string {
+	var global []string
+	if c.GlobalIsSet("rpc-timeout") {
+		global = append(global, "--rpc-timeout", c.GlobalDuration("rpc-timeout").String())
+	}
+	if c.GlobalIsSet("chain") {
+		global = append(global, "--chain", c.GlobalString("chain"))
+	}
+	return global
+}
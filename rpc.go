@@ -0,0 +1,367 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+
+	"context"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// rpcNode is a connected Ethereum JSON-RPC endpoint. Every call made
+// through it, and connecting to it, is bounded by its timeout, unless the
+// timeout is zero.
+type rpcNode struct {
+	url     string
+	raw     *rpc.Client
+	client  *ethclient.Client
+	timeout time.Duration
+}
+
+func dialNode(url string, timeout time.Duration) (*rpcNode, error) {
+	node := &rpcNode{url: url, timeout: timeout}
+	err := node.call(func(ctx context.Context) (err error) {
+		node.raw, err = rpc.DialContext(ctx, url)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	node.client = ethclient.NewClient(node.raw)
+	return node, nil
+}
+
+// dialNodes connects to every given RPC URL.
+func dialNodes(urls []string, timeout time.Duration) ([]*rpcNode, error) {
+	var nodes []*rpcNode
+	for _, url := range urls {
+		node, err := dialNode(url, timeout)
+		if err != nil {
+			closeNodes(nodes)
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+func (node *rpcNode) close() {
+	node.raw.Close()
+}
+
+func closeNodes(nodes []*rpcNode) {
+	for _, node := range nodes {
+		node.close()
+	}
+}
+
+// call runs fn with a context that expires after the node's timeout,
+// reporting an expired deadline as a timeout.
+func (node *rpcNode) call(fn func(ctx context.Context) error) error {
+	ctx := context.Background()
+	if node.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, node.timeout)
+		defer cancel()
+	}
+	err := fn(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("RPC timed out after %s", node.timeout)
+	}
+	return err
+}
+
+// pendingNonce fetches the next nonce of the account, counting
+// transactions still in the node's pool.
+func (node *rpcNode) pendingNonce(account common.Address) (uint64, error) {
+	var nonce uint64
+	err := node.call(func(ctx context.Context) (err error) {
+		nonce, err = node.client.PendingNonceAt(ctx, account)
+		return err
+	})
+	return nonce, err
+}
+
+// balance fetches the account's balance at the latest block.
+func (node *rpcNode) balance(account common.Address) (*big.Int, error) {
+	var balance *big.Int
+	err := node.call(func(ctx context.Context) (err error) {
+		balance, err = node.client.BalanceAt(ctx, account, nil)
+		return err
+	})
+	return balance, err
+}
+
+// estimateGas asks the node how much gas the call would use.
+func (node *rpcNode) estimateGas(msg ethereum.CallMsg) (uint64, error) {
+	var gas uint64
+	err := node.call(func(ctx context.Context) (err error) {
+		gas, err = node.client.EstimateGas(ctx, msg)
+		return err
+	})
+	return gas, err
+}
+
+// suggestGasPrice fetches the node's suggested gas price.
+func (node *rpcNode) suggestGasPrice() (*big.Int, error) {
+	var price *big.Int
+	err := node.call(func(ctx context.Context) (err error) {
+		price, err = node.client.SuggestGasPrice(ctx)
+		return err
+	})
+	return price, err
+}
+
+// chainID fetches the node's chain ID.
+func (node *rpcNode) chainID() (*big.Int, error) {
+	var id hexutil.Big
+	err := node.call(func(ctx context.Context) error {
+		return node.raw.CallContext(ctx, &id, "eth_chainId")
+	})
+	return id.ToInt(), err
+}
+
+// checkNodeChainID refuses a node on another chain than chainID, so that
+// a transaction is not signed for one network and sent to another.
+func checkNodeChainID(node *rpcNode, chainID *big.Int) error {
+	nodeID, err := node.chainID()
+	if err != nil {
+		return fmt.Errorf("ethsign: failed to fetch chain ID from %s: %v", node.url, err)
+	}
+	if nodeID.Cmp(chainID) != 0 {
+		return fmt.Errorf("ethsign: --chain-id is %s (%s) but %s is on chain ID %s (%s)", chainID, chainName(chainID), node.url, nodeID, chainName(nodeID))
+	}
+	return nil
+}
+
+// baseFee fetches the base fee of the latest block, which is nil on
+// chains without EIP-1559.
+func (node *rpcNode) baseFee() (*big.Int, error) {
+	var head struct {
+		BaseFee *hexutil.Big `json:"baseFeePerGas"`
+	}
+	err := node.call(func(ctx context.Context) error {
+		return node.raw.CallContext(ctx, &head, "eth_getBlockByNumber", "latest", false)
+	})
+	if err != nil || head.BaseFee == nil {
+		return nil, err
+	}
+	return head.BaseFee.ToInt(), nil
+}
+
+// suggestTip fetches the node's suggested EIP-1559 priority fee.
+func (node *rpcNode) suggestTip() (*big.Int, error) {
+	var tip hexutil.Big
+	err := node.call(func(ctx context.Context) error {
+		return node.raw.CallContext(ctx, &tip, "eth_maxPriorityFeePerGas")
+	})
+	return tip.ToInt(), err
+}
+
+// createAccessList asks the node for the access list of the call, with
+// eth_createAccessList, and the gas the call uses with that list.
+func (node *rpcNode) createAccessList(msg ethereum.CallMsg) (accessList, uint64, error) {
+	args := map[string]interface{}{
+		"from":  msg.From,
+		"value": (*hexutil.Big)(msg.Value),
+		"data":  hexutil.Bytes(msg.Data),
+	}
+	if msg.To != nil {
+		args["to"] = msg.To
+	}
+	if msg.Gas != 0 {
+		args["gas"] = hexutil.Uint64(msg.Gas)
+	}
+	var result struct {
+		AccessList accessList     `json:"accessList"`
+		GasUsed    hexutil.Uint64 `json:"gasUsed"`
+		Error      string         `json:"error"`
+	}
+	err := node.call(func(ctx context.Context) error {
+		return node.raw.CallContext(ctx, &result, "eth_createAccessList", args, "pending")
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if result.Error != "" {
+		return nil, 0, fmt.Errorf("the call fails: %s", result.Error)
+	}
+	return result.AccessList, uint64(result.GasUsed), nil
+}
+
+// code fetches the account's code at the latest block, which is empty
+// for an account that is not a contract.
+func (node *rpcNode) code(account common.Address) ([]byte, error) {
+	var code []byte
+	err := node.call(func(ctx context.Context) (err error) {
+		code, err = node.client.CodeAt(ctx, account, nil)
+		return err
+	})
+	return code, err
+}
+
+// ethCall runs a call at the latest block with eth_call and returns what
+// it returns. With no recipient, data is run as a contract creation.
+func (node *rpcNode) ethCall(to *common.Address, data []byte) ([]byte, error) {
+	args := map[string]interface{}{"data": hexutil.Bytes(data)}
+	if to != nil {
+		args["to"] = to
+	}
+	var result hexutil.Bytes
+	err := node.call(func(ctx context.Context) error {
+		return node.raw.CallContext(ctx, &result, "eth_call", args, "latest")
+	})
+	return result, err
+}
+
+func (node *rpcNode) sendTransaction(tx *types.Transaction) error {
+	return node.call(func(ctx context.Context) error {
+		return node.client.SendTransaction(ctx, tx)
+	})
+}
+
+// permanentErrors are node responses saying the transaction itself was
+// rejected, so sending it again cannot help.
+var permanentErrors = []string{
+	"nonce too low",
+	"insufficient funds",
+	"underpriced",
+	"intrinsic gas too low",
+	"exceeds block gas limit",
+	"invalid sender",
+	"oversized data",
+	"negative value",
+}
+
+// isAlreadyKnown reports whether the node refused the transaction only
+// because it already has it, which means the broadcast has succeeded.
+func isAlreadyKnown(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "already known") || strings.Contains(msg, "known transaction")
+}
+
+func isPermanent(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, permanent := range permanentErrors {
+		if strings.Contains(msg, permanent) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryPolicy says how many times to retry a failed call that might
+// succeed later, such as a rate limit, a 503 or a reset connection, and
+// how long to wait before the first retry. The wait doubles each time.
+type retryPolicy struct {
+	retries int
+	delay   time.Duration
+	verbose bool
+}
+
+// do calls fn until it succeeds, fails permanently or runs out of retries.
+func (p retryPolicy) do(what string, fn func() error) error {
+	delay := p.delay
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || isPermanent(err) || isAlreadyKnown(err) || attempt >= p.retries {
+			return err
+		}
+		if p.verbose {
+			fmt.Fprintf(os.Stderr, "%s failed (attempt %d of %d): %v; retrying in %s\n", what, attempt+1, p.retries+1, err, delay)
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// broadcast sends the transaction to every node, reporting the outcome
+// per node on stderr, and returns how many nodes accepted it or already
+// had it.
+func broadcast(nodes []*rpcNode, tx *types.Transaction, retry retryPolicy) int {
+	accepted := 0
+	for _, node := range nodes {
+		err := retry.do("sending "+tx.Hash().Hex()+" to "+node.url, func() error {
+			return node.sendTransaction(tx)
+		})
+		if err != nil && isAlreadyKnown(err) {
+			fmt.Fprintf(os.Stderr, "%s already has %s\n", node.url, tx.Hash().Hex())
+			accepted++
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ethsign: %s rejected %s: %v\n", node.url, tx.Hash().Hex(), err)
+			continue
+		}
+		if len(nodes) > 1 {
+			fmt.Fprintf(os.Stderr, "%s accepted %s\n", node.url, tx.Hash().Hex())
+		}
+		accepted++
+	}
+	return accepted
+}
+
+// checkPendingNonce refuses to send tx unless every node's pending nonce
+// for its sender is the transaction's nonce, so that a transaction whose
+// nonce has already been used is not broadcast again.
+func checkPendingNonce(nodes []*rpcNode, tx *types.Transaction) error {
+	var signer types.Signer = types.HomesteadSigner{}
+	if tx.Protected() {
+		signer = types.NewEIP155Signer(tx.ChainId())
+	}
+	from, err := types.Sender(signer, tx)
+	if err != nil {
+		return err
+	}
+	for _, node := range nodes {
+		pending, err := node.pendingNonce(from)
+		if err != nil {
+			return fmt.Errorf("failed to fetch pending nonce from %s: %v", node.url, err)
+		}
+		if pending != tx.Nonce() {
+			return fmt.Errorf("%s expects nonce %d from %s, but the transaction has nonce %d", node.url, pending, from.Hex(), tx.Nonce())
+		}
+	}
+	return nil
+}
+
+// pendingNonce fetches the next nonce of the account from the node at url.
+func pendingNonce(url string, timeout time.Duration, account common.Address) (uint64, error) {
+	node, err := dialNode(url, timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer node.close()
+	return node.pendingNonce(account)
+}
+
+// rpcRequest is a JSON-RPC 2.0 request.
+type rpcRequest struct {
+	JSONRPC string        `json:"jsonrpc"`
+	ID      int           `json:"id"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+// sendRawBatch builds a JSON-RPC batch with one eth_sendRawTransaction
+// call per transaction, numbered from 1 in order.
+func sendRawBatch(txs []*types.Transaction) ([]rpcRequest, error) {
+	batch := []rpcRequest{}
+	for i, tx := range txs {
+		encoded, err := rlp.EncodeToBytes(tx)
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, rpcRequest{"2.0", i + 1, "eth_sendRawTransaction", []interface{}{hexutil.Bytes(encoded)}})
+	}
+	return batch, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeNode serves JSON-RPC over HTTP for the test, answering each method
+// with its result in results and any other method with an error. A
+// result that is a fakeResult is called with the request's parameters.
+func fakeNode(t *testing.T, results map[string]interface{}) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage   `json:"id"`
+			Method string            `json:"method"`
+			Params []json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := map[string]interface{}{"jsonrpc": "2.0", "id": req.ID}
+		if result, ok := results[req.Method]; ok {
+			if fn, ok := result.(fakeResult); ok {
+				result = fn(req.Params)
+			}
+			resp["result"] = result
+		} else {
+			resp["error"] = map[string]interface{}{"code": -32601, "message": "the method " + req.Method + " does not exist"}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// fakeResult answers a fakeNode request from its parameters.
+type fakeResult func(params []json.RawMessage) interface{}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		err      string
+		retries  int
+		attempts int
+	}{
+		{"", 3, 1},
+		{"503 Service Unavailable", 3, 4},
+		{"503 Service Unavailable", 0, 1},
+		{"nonce too low", 3, 1},
+		{"already known", 3, 1},
+		{"known transaction: 0x1234", 3, 1},
+	}
+	for _, test := range tests {
+		attempts := 0
+		retryPolicy{retries: test.retries}.do("test", func() error {
+			attempts++
+			if test.err == "" {
+				return nil
+			}
+			return errors.New(test.err)
+		})
+		if attempts != test.attempts {
+			t.Errorf("%q with %d retries: got %d attempts, want %d", test.err, test.retries, attempts, test.attempts)
+		}
+	}
+}
+
+func TestIsAlreadyKnown(t *testing.T) {
+	tests := []struct {
+		err   string
+		known bool
+	}{
+		{"already known", true},
+		{"Known transaction: 5a6b", true},
+		{"nonce too low", false},
+		{"replacement transaction underpriced", false},
+	}
+	for _, test := range tests {
+		if got := isAlreadyKnown(errors.New(test.err)); got != test.known {
+			t.Errorf("%q: got %v, want %v", test.err, got, test.known)
+		}
+		if isPermanent(errors.New(test.err)) && test.known {
+			t.Errorf("%q: treated as a permanent failure", test.err)
+		}
+	}
+}
+
+func TestCheckNodeChainID(t *testing.T) {
+	node, err := dialNode(fakeNode(t, map[string]interface{}{"eth_chainId": "0xaa36a7"}), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.close()
+	if err := checkNodeChainID(node, big.NewInt(11155111)); err != nil {
+		t.Errorf("same chain: %v", err)
+	}
+	err = checkNodeChainID(node, big.NewInt(1))
+	if err == nil || !strings.Contains(err.Error(), "--chain-id is 1 (Ethereum Mainnet)") || !strings.Contains(err.Error(), "chain ID 11155111 (Sepolia)") {
+		t.Errorf("other chain: got %v", err)
+	}
+}
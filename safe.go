@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"encoding/json"
+	"math/big"
+)
+
+// checksumAddress is an address that is encoded in JSON with its EIP-55
+// checksum rather than in lower case.
+type checksumAddress common.Address
+
+func (a checksumAddress) MarshalJSON() ([]byte, error) {
+	return json.Marshal(common.Address(a).Hex())
+}
+
+// safeTx is a Safe multisig transaction, in the JSON body the Safe
+// Transaction Service takes when proposing one. Amounts are encoded as
+// plain JSON numbers, empty data as null, and addresses with their
+// EIP-55 checksum, which the service insists on.
+type safeTx struct {
+	Safe                    checksumAddress `json:"safe"`
+	To                      checksumAddress `json:"to"`
+	Value                   *big.Int        `json:"value"`
+	Data                    *hexutil.Bytes  `json:"data"`
+	Operation               uint8           `json:"operation"`
+	SafeTxGas               *big.Int        `json:"safeTxGas"`
+	BaseGas                 *big.Int        `json:"baseGas"`
+	GasPrice                *big.Int        `json:"gasPrice"`
+	GasToken                checksumAddress `json:"gasToken"`
+	RefundReceiver          checksumAddress `json:"refundReceiver"`
+	Nonce                   *big.Int        `json:"nonce"`
+	ContractTransactionHash common.Hash     `json:"contractTransactionHash"`
+	Sender                  checksumAddress `json:"sender"`
+	Signature               hexutil.Bytes   `json:"signature"`
+}
+
+// hash computes the EIP-712 hash a Safe (v1.3 and later) owner signs to
+// approve the transaction, as Safe.getTransactionHash does.
+func (tx *safeTx) hash(chainID *big.Int) []byte {
+	var data []byte
+	if tx.Data != nil {
+		data = *tx.Data
+	}
+	separator := hashStruct("EIP712Domain(uint256 chainId,address verifyingContract)", chainID, common.Address(tx.Safe))
+	structHash := hashStruct(
+		"SafeTx(address to,uint256 value,bytes data,uint8 operation,uint256 safeTxGas,uint256 baseGas,uint256 gasPrice,address gasToken,address refundReceiver,uint256 nonce)",
+		common.Address(tx.To), tx.Value, crypto.Keccak256(data), tx.Operation, tx.SafeTxGas, tx.BaseGas, tx.GasPrice,
+		common.Address(tx.GasToken), common.Address(tx.RefundReceiver), tx.Nonce,
+	)
+	return typedDataHash(separator, structHash)
+}
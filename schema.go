@@ -0,0 +1,387 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// schemaField is one member of a schema struct.
+type schemaField struct {
+	name string
+	typ  string
+}
+
+// schema describes an EIP-712 struct and the structs it refers to.
+// Schema files hold each struct's name on a line of its own followed by
+// one "name type" member per line, with # starting a comment. The first
+// struct is the one that is signed; the others may come in any order:
+//
+//   Mail
+//   from     Person
+//   to       Person[]
+//   contents string
+//
+//   Person
+//   name   Name
+//   wallet address
+//
+//   Name
+//   first string
+//   last  string
+//
+// Members may be address, bool, string, bytes, bytes1 to bytes32,
+// uint8 to uint256, int8 to int256, a struct in the file, or an array
+// T[] or T[n] of any of these.
+type schema struct {
+	name    string
+	structs map[string][]schemaField
+}
+
+func readSchema(path string) (*schema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := &schema{structs: make(map[string][]schemaField)}
+	var current string
+	var seen map[string]bool
+	lines := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+
+		if len(words) == 1 {
+			if _, ok := s.structs[words[0]]; ok {
+				return nil, fmt.Errorf("line %d: duplicate struct %q", n, words[0])
+			}
+			if _, err := encodeSchemaValue(words[0], zeroSchemaValue(words[0])); err == nil || strings.Contains(words[0], "[") {
+				return nil, fmt.Errorf("line %d: struct %q is named like a type", n, words[0])
+			}
+			if s.name == "" {
+				s.name = words[0]
+			}
+			current, seen = words[0], make(map[string]bool)
+			s.structs[current] = nil
+			continue
+		}
+
+		if current == "" {
+			return nil, fmt.Errorf("line %d: expected the struct name", n)
+		}
+		if len(words) != 2 {
+			return nil, fmt.Errorf("line %d: expected \"name type\"", n)
+		}
+		if seen[words[0]] {
+			return nil, fmt.Errorf("line %d: duplicate member %q", n, words[0])
+		}
+		seen[words[0]] = true
+		s.structs[current] = append(s.structs[current], schemaField{words[0], words[1]})
+		lines[current+"."+words[0]] = n
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if s.name == "" {
+		return nil, fmt.Errorf("schema is empty")
+	}
+
+	// Structs may be used before they are defined, so member types are
+	// only checked once the whole file is read.
+	for name, fields := range s.structs {
+		for _, f := range fields {
+			base, _, err := splitArrayType(f.typ)
+			if err == nil {
+				if _, ok := s.structs[base]; !ok {
+					_, err = encodeSchemaValue(base, zeroSchemaValue(base))
+				}
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: unsupported type %q", lines[name+"."+f.name], f.typ)
+			}
+		}
+	}
+	return s, nil
+}
+
+// splitArrayType splits an array type such as "Person[2][]" into the
+// type of its elements, "Person[2]", and its length, or -1 for a
+// dynamic array. Other types are returned whole with a length of 0.
+func splitArrayType(typ string) (string, int, error) {
+	if !strings.HasSuffix(typ, "]") {
+		return typ, 0, nil
+	}
+	i := strings.LastIndex(typ, "[")
+	if i <= 0 {
+		return "", 0, fmt.Errorf("invalid array type %q", typ)
+	}
+	if typ[i+1:len(typ)-1] == "" {
+		return typ[:i], -1, nil
+	}
+	length, err := strconv.Atoi(typ[i+1 : len(typ)-1])
+	if err != nil || length < 1 {
+		return "", 0, fmt.Errorf("invalid array type %q", typ)
+	}
+	return typ[:i], length, nil
+}
+
+// baseType strips every array suffix from a type.
+func baseType(typ string) string {
+	if i := strings.Index(typ, "["); i >= 0 {
+		return typ[:i]
+	}
+	return typ
+}
+
+// typeString is the EIP-712 encoding of a struct type, such as
+// "Mail(Person from,string contents)Person(string name,address wallet)":
+// the struct followed by every struct it refers to, directly or not,
+// sorted by name.
+func (s *schema) typeString(name string) string {
+	deps := make(map[string]bool)
+	var collect func(string)
+	collect = func(name string) {
+		for _, f := range s.structs[name] {
+			base := baseType(f.typ)
+			if _, ok := s.structs[base]; ok && !deps[base] {
+				deps[base] = true
+				collect(base)
+			}
+		}
+	}
+	collect(name)
+	delete(deps, name)
+
+	var sorted []string
+	for dep := range deps {
+		sorted = append(sorted, dep)
+	}
+	sort.Strings(sorted)
+
+	encoded := ""
+	for _, t := range append([]string{name}, sorted...) {
+		var members []string
+		for _, f := range s.structs[t] {
+			members = append(members, f.typ+" "+f.name)
+		}
+		encoded += t + "(" + strings.Join(members, ",") + ")"
+	}
+	return encoded
+}
+
+// hash computes the struct hash of the signed struct for the given
+// member values, all of which must be present. Struct and array members
+// are given as JSON, such as {"name": {"first": "Cow", "last": "Moo"},
+// "wallet": "0xCD2a..."} or ["0x1234", "0x5678"]; numbers in JSON may be
+// strings or plain numbers.
+func (s *schema) hash(values map[string]string) ([]byte, error) {
+	members, err := s.members(values)
+	if err != nil {
+		return nil, err
+	}
+	return s.hashStruct(s.name, members)
+}
+
+// members decodes the JSON of the struct and array member values.
+func (s *schema) members(values map[string]string) (map[string]interface{}, error) {
+	members := make(map[string]interface{})
+	for name, value := range values {
+		members[name] = value
+		for _, f := range s.structs[s.name] {
+			if f.name != name {
+				continue
+			}
+			if _, ok := s.structs[baseType(f.typ)]; ok || strings.HasSuffix(f.typ, "]") {
+				decoder := json.NewDecoder(strings.NewReader(value))
+				decoder.UseNumber()
+				var decoded interface{}
+				if err := decoder.Decode(&decoded); err != nil {
+					return nil, fmt.Errorf("%s: invalid JSON: %v", name, err)
+				}
+				members[name] = decoded
+			}
+		}
+	}
+	return members, nil
+}
+
+func (s *schema) hashStruct(name string, members map[string]interface{}) ([]byte, error) {
+	for member := range members {
+		found := false
+		for _, f := range s.structs[name] {
+			found = found || f.name == member
+		}
+		if !found {
+			return nil, fmt.Errorf("%s has no member %q", name, member)
+		}
+	}
+
+	var encoded []interface{}
+	for _, f := range s.structs[name] {
+		value, ok := members[f.name]
+		if !ok {
+			return nil, fmt.Errorf("missing value for %s", f.name)
+		}
+		word, err := s.encodeValue(f.typ, value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f.name, err)
+		}
+		encoded = append(encoded, word)
+	}
+	return hashStruct(s.typeString(name), encoded...), nil
+}
+
+// encodeValue encodes a member value that may be a struct or an array,
+// as decoded from JSON, into a word for encodeWords. Structs are encoded
+// as their struct hash and arrays as the hash of their encoded elements.
+func (s *schema) encodeValue(typ string, value interface{}) (interface{}, error) {
+	if base, length, err := splitArrayType(typ); err != nil {
+		return nil, err
+	} else if length != 0 {
+		elements, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array for %s", typ)
+		}
+		if length > 0 && len(elements) != length {
+			return nil, fmt.Errorf("expected %d elements for %s, got %d", length, typ, len(elements))
+		}
+		var words []interface{}
+		for i, element := range elements {
+			word, err := s.encodeValue(base, element)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			words = append(words, word)
+		}
+		return crypto.Keccak256(encodeWords(words...)), nil
+	}
+
+	if _, ok := s.structs[typ]; ok {
+		members, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an object for %s", typ)
+		}
+		return s.hashStruct(typ, members)
+	}
+
+	leaf, ok := schemaLeaf(value)
+	if !ok {
+		return nil, fmt.Errorf("expected a value for %s", typ)
+	}
+	return encodeSchemaValue(typ, leaf)
+}
+
+// schemaLeaf gives a member value that is not a struct or an array as
+// the string --field would give it.
+func schemaLeaf(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// zeroSchemaValue is a valid value of the type, used to check types.
+func zeroSchemaValue(typ string) string {
+	switch typ {
+	case "address":
+		return "0x0000000000000000000000000000000000000000"
+	case "bool":
+		return "false"
+	case "string":
+		return ""
+	}
+	if strings.HasPrefix(typ, "bytes") {
+		return "0x"
+	}
+	return "0"
+}
+
+// encodeSchemaValue parses a value of an EIP-712 type into something
+// encodeWords accepts. Dynamic values are hashed, as EIP-712 requires.
+func encodeSchemaValue(typ string, value string) (interface{}, error) {
+	switch {
+	case typ == "address":
+		if !common.IsHexAddress(value) {
+			return nil, fmt.Errorf("invalid address %q", value)
+		}
+		return common.HexToAddress(value), nil
+
+	case typ == "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool %q", value)
+		}
+		if b {
+			return uint8(1), nil
+		}
+		return uint8(0), nil
+
+	case typ == "string":
+		return crypto.Keccak256([]byte(value)), nil
+
+	case typ == "bytes":
+		b, err := parseHex(value)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(b), nil
+
+	case strings.HasPrefix(typ, "bytes"):
+		size, err := strconv.Atoi(strings.TrimPrefix(typ, "bytes"))
+		if err != nil || size < 1 || size > 32 {
+			return nil, fmt.Errorf("unsupported type %q", typ)
+		}
+		b, err := parseHex(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > size {
+			return nil, fmt.Errorf("%d bytes is too long for %s", len(b), typ)
+		}
+		return common.RightPadBytes(b, 32), nil
+
+	case strings.HasPrefix(typ, "uint"), strings.HasPrefix(typ, "int"):
+		signed := strings.HasPrefix(typ, "int")
+		bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(typ, "u"), "int"))
+		if err != nil || bits < 8 || bits > 256 || bits%8 != 0 {
+			return nil, fmt.Errorf("unsupported type %q", typ)
+		}
+		n, ok := new(big.Int).SetString(value, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", value)
+		}
+		min, max := big.NewInt(0), math.BigPow(2, int64(bits))
+		if signed {
+			max = math.BigPow(2, int64(bits-1))
+			min = new(big.Int).Neg(max)
+		}
+		if n.Cmp(min) < 0 || n.Cmp(max) >= 0 {
+			return nil, fmt.Errorf("%s out of range for %s", value, typ)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", typ)
+}
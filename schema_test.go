@@ -0,0 +1,144 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSchema(t *testing.T, dir string, contents string) string {
+	path := filepath.Join(dir, "schema")
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// TestSchemaNestedStructs checks the struct hash and digest of nested
+// structs against the example in EIP-712 and against go-ethereum's
+// apitypes, with a struct two levels deep, an array of structs and
+// structs used before they are defined.
+func TestSchemaNestedStructs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethsign-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	separator := domainSeparator("Ether Mail", "1", big.NewInt(1), common.HexToAddress("0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"))
+	if want := "0xf2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f"; hexutil.Encode(separator) != want {
+		t.Fatalf("domain separator: got %s, want %s", hexutil.Encode(separator), want)
+	}
+
+	tests := []struct {
+		name       string
+		schema     string
+		values     map[string]string
+		typeString string
+		structHash string
+		digest     string
+	}{
+		{
+			name:   "EIP-712 example",
+			schema: "Mail\nfrom Person\nto Person\ncontents string\n\nPerson\nname string\nwallet address\n",
+			values: map[string]string{
+				"from":     `{"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"}`,
+				"to":       `{"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"}`,
+				"contents": "Hello, Bob!",
+			},
+			typeString: "Mail(Person from,Person to,string contents)Person(string name,address wallet)",
+			structHash: "0xc52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e",
+			digest:     "0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2",
+		},
+		{
+			name: "two levels and arrays",
+			schema: `Mail
+from     Person
+to       Person[]
+contents string
+tags     uint16[]
+
+# Defined after Person refers to it.
+Person
+name   Name
+wallet address
+
+Name
+first string
+last  string
+`,
+			values: map[string]string{
+				"from": `{"name": {"first": "Cow", "last": "Moo"}, "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"}`,
+				"to": `[{"name": {"first": "Bob", "last": "B"}, "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+					{"name": {"first": "Eve", "last": ""}, "wallet": "0xDeaDbeefdEAdbeefdEadbEEFdeadbeEFdEaDbeeF"}]`,
+				"contents": "Hello, Bob!",
+				"tags":     `[1, "65535"]`,
+			},
+			typeString: "Mail(Person from,Person[] to,string contents,uint16[] tags)Name(string first,string last)Person(Name name,address wallet)",
+			structHash: "0x8351965b3ab1fe82a0ba3540c97bb12e995f5e8ef99fd2637dba9c5828a51c35",
+			digest:     "0xa583079c914626636d8fe9816f30ac5a8c71981725ebd2d4dd125d266b4359a5",
+		},
+	}
+	for _, test := range tests {
+		sch, err := readSchema(writeSchema(t, dir, test.schema))
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := sch.typeString(sch.name); got != test.typeString {
+			t.Errorf("%s: got type %s, want %s", test.name, got, test.typeString)
+		}
+		structHash, err := sch.hash(test.values)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got := hexutil.Encode(structHash); got != test.structHash {
+			t.Errorf("%s: got struct hash %s, want %s", test.name, got, test.structHash)
+		}
+		if got := hexutil.Encode(typedDataHash(separator, structHash)); got != test.digest {
+			t.Errorf("%s: got digest %s, want %s", test.name, got, test.digest)
+		}
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethsign-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const people = "Group\nmembers Person[2]\n\nPerson\nname string\n"
+	tests := []struct {
+		schema string
+		values map[string]string
+		err    string
+	}{
+		{schema: "Mail\nfrom Person\n", err: `line 2: unsupported type "Person"`},
+		{schema: "Mail\nto Person[x]\n\nPerson\nname string\n", err: `line 2: unsupported type "Person[x]"`},
+		{schema: "Mail\nname string\n\nMail\nname string\n", err: `line 4: duplicate struct "Mail"`},
+		{schema: "uint256\nname string\n", err: "named like a type"},
+		{schema: people, values: map[string]string{"members": `[{"name": "a"}]`}, err: "expected 2 elements"},
+		{schema: people, values: map[string]string{"members": `{"name": "a"}`}, err: "expected an array"},
+		{schema: people, values: map[string]string{"members": `[{"name": "a"}, "b"]`}, err: "[1]: expected an object"},
+		{schema: people, values: map[string]string{"members": `[{"name": "a"}, {"nick": "b"}]`}, err: `Person has no member "nick"`},
+		{schema: people, values: map[string]string{"members": `[{"name": "a"}, {}]`}, err: "missing value for name"},
+		{schema: people, values: map[string]string{"members": `[{"name": "a"`}, err: "invalid JSON"},
+	}
+	for _, test := range tests {
+		sch, err := readSchema(writeSchema(t, dir, test.schema))
+		if err == nil {
+			_, err = sch.hash(test.values)
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: got error %v, want %q", test.schema, err, test.err)
+		}
+	}
+}
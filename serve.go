@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// serving is set while serve runs commands for its clients, which must
+// not read the server's stdin or prompt on its terminal.
+var serving bool
+
+// serveRequest is one line sent to a serve socket: the arguments of an
+// ethsign command, such as ["message", "--from", "0x...", "--data", "0x00"].
+type serveRequest struct {
+	Args []string `json:"args"`
+}
+
+// serveResponse is the line sent back, with what the command printed to
+// stdout, or the error it failed with.
+type serveResponse struct {
+	Output string `json:"output"`
+	Error  string `json:"error,omitempty"`
+}
+
+// serve listens on a Unix socket readable only by the current user and
+// runs the commands it receives one at a time, like repl does. Commands
+// cannot prompt or read stdin, so passphrases must come from
+// --passphrase-file or the keychain, and confirmations need --yes.
+func serve(app *cli.App, path string, global []string) error {
+	if _, err := os.Lstat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return fmt.Errorf("ethsign: %s is in use by another server", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("ethsign: failed to remove stale socket: %v", err)
+		}
+	}
+
+	listener, err := listenPrivate(path)
+	if err != nil {
+		return fmt.Errorf("ethsign: %v", err)
+	}
+	defer listener.Close()
+	if err := os.Chmod(path, 0600); err != nil {
+		return fmt.Errorf("ethsign: %v", err)
+	}
+	serving = true
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", path)
+
+	var mu sync.Mutex
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return nil
+		}
+		go func() {
+			defer conn.Close()
+			lines := bufio.NewReader(conn)
+			encoder := json.NewEncoder(conn)
+			for {
+				line, err := lines.ReadBytes('\n')
+				if len(line) == 0 && err != nil {
+					return
+				}
+				var req serveRequest
+				if err := json.Unmarshal(line, &req); err != nil {
+					encoder.Encode(serveResponse{Error: "ethsign: invalid request: " + err.Error()})
+					continue
+				}
+				mu.Lock()
+				resp := runCaptured(app, global, req.Args)
+				mu.Unlock()
+				if encoder.Encode(resp) != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// runCaptured runs a command with its stdout captured.
+func runCaptured(app *cli.App, global []string, args []string) serveResponse {
+	if len(args) == 0 {
+		return serveResponse{Error: "ethsign: empty request"}
+	}
+	if args[0] == "serve" || args[0] == "repl" {
+		return serveResponse{Error: "ethsign: cannot run " + args[0] + " from serve"}
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return serveResponse{Error: "ethsign: " + err.Error()}
+	}
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(&out, r)
+		close(done)
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = w
+	argv := append([]string{app.Name}, global...)
+	err = app.Run(append(argv, args...))
+	os.Stdout = stdout
+	w.Close()
+	<-done
+	r.Close()
+
+	resp := serveResponse{Output: out.String()}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
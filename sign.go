@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"math/big"
+)
+
+// signLegacyTx signs a legacy transaction for chainID (EIP-155) and
+// returns it with its encoding as sent to a node.
+func signLegacyTx(wallet accounts.Wallet, acct accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, []byte, error) {
+	signed, err := wallet.SignTxWithPassphrase(acct, passphrase, tx, chainID)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded, err := rlp.EncodeToBytes(signed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return signed, encoded, nil
+}
+
+// signTypedTx signs a typed transaction and returns it with its encoding
+// as sent to a node.
+func signTypedTx(wallet accounts.Wallet, acct accounts.Account, passphrase string, tx *typedTx) (*typedTx, []byte, error) {
+	hash := tx.sigHash()
+	sig, err := wallet.SignHashWithPassphrase(acct, passphrase, hash[:])
+	if err != nil {
+		return nil, nil, err
+	}
+	signed, err := tx.withSignature(sig)
+	if err != nil {
+		return nil, nil, err
+	}
+	encoded, err := signed.encode()
+	if err != nil {
+		return nil, nil, err
+	}
+	return signed, encoded, nil
+}
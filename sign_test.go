@@ -0,0 +1,167 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"strings"
+	"testing"
+)
+
+// simChain is an in-memory chain that takes raw signed transactions the
+// way a node does. backends.SimulatedBackend in the pinned go-ethereum
+// recovers senders with the Homestead signer, so it panics on EIP-155
+// transactions, which are all that ethsign signs; simChain makes blocks
+// with core.GenerateChain as the backend does, but checks senders with
+// the chain's own signer.
+type simChain struct {
+	db     ethdb.Database
+	chain  *core.BlockChain
+	config *params.ChainConfig
+}
+
+func newSimChain(t *testing.T, alloc core.GenesisAlloc) *simChain {
+	db, err := ethdb.NewMemDatabase()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Chain ID 1337, with every fork up to Byzantium from the start.
+	genesis := core.Genesis{Config: params.AllEthashProtocolChanges, Alloc: alloc}
+	genesis.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, ethash.NewFaker(), vm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &simChain{db, chain, genesis.Config}
+}
+
+// mine decodes raw transactions, includes them in a new block and
+// returns their receipts. Like the simulated backend, it checks senders
+// and nonces first, since BlockGen.AddTx panics on a transaction that
+// cannot be applied.
+func (s *simChain) mine(raws ...[]byte) (types.Receipts, error) {
+	parent := s.chain.CurrentBlock()
+	signer := types.MakeSigner(s.config, new(big.Int).Add(parent.Number(), big.NewInt(1)))
+	state, err := s.chain.State()
+	if err != nil {
+		return nil, err
+	}
+
+	var txs []*types.Transaction
+	for i, raw := range raws {
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(raw, tx); err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		sender, err := types.Sender(signer, tx)
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d: %v", i, err)
+		}
+		if nonce := state.GetNonce(sender); tx.Nonce() != nonce {
+			return nil, fmt.Errorf("transaction %d: nonce %d is not the next nonce, %d", i, tx.Nonce(), nonce)
+		}
+		state.SetNonce(sender, tx.Nonce()+1)
+		txs = append(txs, tx)
+	}
+
+	blocks, receipts := core.GenerateChain(s.config, parent, ethash.NewFaker(), s.db, 1, func(_ int, block *core.BlockGen) {
+		for _, tx := range txs {
+			block.AddTx(tx)
+		}
+	})
+	if _, err := s.chain.InsertChain(blocks); err != nil {
+		return nil, err
+	}
+	return receipts[0], nil
+}
+
+// TestSignOnSimulatedChain signs transactions through signLegacyTx and
+// mines them on a simulated chain, checking the receipts, balances and
+// nonces, and that the chain refuses a wrong chain ID or a reused nonce.
+func TestSignOnSimulatedChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ethsign-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ks := keystore.NewKeyStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	acct, err := ks.NewAccount("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallet := ks.Wallets()[0]
+
+	ether := new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil)
+	sim := newSimChain(t, core.GenesisAlloc{acct.Address: {Balance: ether}})
+	chainID := sim.config.ChainId
+	to := common.HexToAddress("0x00000000000000000000000000000000000000aa")
+	gasPrice := big.NewInt(1000000000)
+
+	sign := func(nonce uint64, value int64, chainID *big.Int) []byte {
+		tx := types.NewTransaction(nonce, to, big.NewInt(value), intrinsicGas(nil, false), gasPrice, nil)
+		signed, encoded, err := signLegacyTx(wallet, acct, "test", tx, chainID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mismatches, err := verifyEncodedTx(encoded, tx, acct.Address, chainID); err != nil || len(mismatches) > 0 {
+			t.Fatalf("nonce %d: %v %v", nonce, err, mismatches)
+		}
+		if !signed.Protected() {
+			t.Fatalf("nonce %d: not replay protected", nonce)
+		}
+		return encoded
+	}
+
+	receipts, err := sim.mine(sign(0, 1000, chainID), sign(1, 2000, chainID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, receipt := range receipts {
+		if receipt.Status != types.ReceiptStatusSuccessful || receipt.GasUsed != 21000 {
+			t.Errorf("receipt %d: status %d, gas used %d", i, receipt.Status, receipt.GasUsed)
+		}
+	}
+
+	state, err := sim.chain.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := state.GetBalance(to); got.Cmp(big.NewInt(3000)) != 0 {
+		t.Errorf("recipient balance: got %s, want 3000", got)
+	}
+	if got := state.GetNonce(acct.Address); got != 2 {
+		t.Errorf("sender nonce: got %d, want 2", got)
+	}
+	spent := new(big.Int).Mul(big.NewInt(2*21000), gasPrice)
+	spent.Add(spent, big.NewInt(3000))
+	if got := state.GetBalance(acct.Address); got.Cmp(new(big.Int).Sub(ether, spent)) != 0 {
+		t.Errorf("sender balance: got %s, want %s", got, new(big.Int).Sub(ether, spent))
+	}
+
+	tests := []struct {
+		name string
+		raw  []byte
+		err  string
+	}{
+		{"other chain", sign(2, 1, big.NewInt(1)), "chain id"},
+		{"reused nonce", sign(1, 1, chainID), "nonce 1 is not the next nonce, 2"},
+		{"skipped nonce", sign(3, 1, chainID), "nonce 3 is not the next nonce, 2"},
+	}
+	for _, test := range tests {
+		if _, err := sim.mine(test.raw); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// siweMessage is an EIP-4361 Sign-In with Ethereum message.
+type siweMessage struct {
+	Domain         string
+	Address        common.Address
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        *big.Int
+	Nonce          string
+	IssuedAt       string
+	ExpirationTime string
+	NotBefore      string
+	RequestID      string
+	Resources      []string
+}
+
+// String formats the message following the EIP-4361 grammar. Optional
+// fields are left out when empty, and there is no trailing newline.
+func (m *siweMessage) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s wants you to sign in with your Ethereum account:\n", m.Domain)
+	fmt.Fprintf(&b, "%s\n\n", m.Address.Hex())
+	if m.Statement != "" {
+		fmt.Fprintf(&b, "%s\n", m.Statement)
+	}
+	fmt.Fprintf(&b, "\nURI: %s", m.URI)
+	fmt.Fprintf(&b, "\nVersion: %s", m.Version)
+	fmt.Fprintf(&b, "\nChain ID: %s", m.ChainID)
+	fmt.Fprintf(&b, "\nNonce: %s", m.Nonce)
+	fmt.Fprintf(&b, "\nIssued At: %s", m.IssuedAt)
+	if m.ExpirationTime != "" {
+		fmt.Fprintf(&b, "\nExpiration Time: %s", m.ExpirationTime)
+	}
+	if m.NotBefore != "" {
+		fmt.Fprintf(&b, "\nNot Before: %s", m.NotBefore)
+	}
+	if m.RequestID != "" {
+		fmt.Fprintf(&b, "\nRequest ID: %s", m.RequestID)
+	}
+	if len(m.Resources) > 0 {
+		fmt.Fprintf(&b, "\nResources:")
+		for _, r := range m.Resources {
+			fmt.Fprintf(&b, "\n- %s", r)
+		}
+	}
+	return b.String()
+}
+
+// checkSiweNonce checks that a nonce is at least 8 alphanumeric
+// characters, as EIP-4361 requires.
+func checkSiweNonce(nonce string) error {
+	if len(nonce) < 8 {
+		return fmt.Errorf("nonce must be at least 8 characters")
+	}
+	for _, r := range nonce {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return fmt.Errorf("nonce must be alphanumeric")
+		}
+	}
+	return nil
+}
+
+// parseSiweMessage reads back the address and the time bounds of a
+// formatted message, which is what verification needs.
+func parseSiweMessage(text string) (*siweMessage, error) {
+	lines := strings.Split(text, "\n")
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], " wants you to sign in with your Ethereum account:") {
+		return nil, fmt.Errorf("not a Sign-In with Ethereum message")
+	}
+	if !common.IsHexAddress(lines[1]) || common.HexToAddress(lines[1]).Hex() != lines[1] {
+		return nil, fmt.Errorf("address %q is not EIP-55 checksummed", lines[1])
+	}
+
+	m := &siweMessage{
+		Domain:  strings.TrimSuffix(lines[0], " wants you to sign in with your Ethereum account:"),
+		Address: common.HexToAddress(lines[1]),
+	}
+	for _, line := range lines[2:] {
+		switch {
+		case strings.HasPrefix(line, "Chain ID: "):
+			chainID, ok := new(big.Int).SetString(strings.TrimPrefix(line, "Chain ID: "), 10)
+			if !ok {
+				return nil, fmt.Errorf("invalid chain ID %q", line)
+			}
+			m.ChainID = chainID
+		case strings.HasPrefix(line, "Expiration Time: "):
+			m.ExpirationTime = strings.TrimPrefix(line, "Expiration Time: ")
+		case strings.HasPrefix(line, "Not Before: "):
+			m.NotBefore = strings.TrimPrefix(line, "Not Before: ")
+		}
+	}
+	return m, nil
+}
+
+// checkSiweTimes fails if the message has expired or is not valid yet.
+func checkSiweTimes(m *siweMessage, now time.Time) error {
+	if m.ExpirationTime != "" {
+		t, err := time.Parse(time.RFC3339, m.ExpirationTime)
+		if err != nil {
+			return fmt.Errorf("invalid expiration time %q", m.ExpirationTime)
+		}
+		if !now.Before(t) {
+			return fmt.Errorf("message expired at %s", m.ExpirationTime)
+		}
+	}
+	if m.NotBefore != "" {
+		t, err := time.Parse(time.RFC3339, m.NotBefore)
+		if err != nil {
+			return fmt.Errorf("invalid not-before time %q", m.NotBefore)
+		}
+		if now.Before(t) {
+			return fmt.Errorf("message is not valid before %s", m.NotBefore)
+		}
+	}
+	return nil
+}
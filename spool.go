@@ -0,0 +1,63 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// spooledTx is a signed transaction waiting in a spool directory.
+type spooledTx struct {
+	path string
+	tx   *types.Transaction
+}
+
+// writeSpool stores the signed transaction in dir as <txhash>.hex.
+func writeSpool(dir string, tx *types.Transaction) (string, error) {
+	encoded, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, tx.Hash().Hex()+".hex")
+	return path, ioutil.WriteFile(path, []byte(hexutil.Encode(encoded)+"\n"), 0600)
+}
+
+// readSpool decodes every spooled transaction in dir, sorted by nonce.
+func readSpool(dir string) ([]spooledTx, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.hex"))
+	if err != nil {
+		return nil, err
+	}
+
+	var spooled []spooledTx
+	for _, path := range paths {
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		encoded, err := parseHex(strings.TrimSpace(string(contents)))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		tx := new(types.Transaction)
+		if err := rlp.DecodeBytes(encoded, tx); err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		spooled = append(spooled, spooledTx{path, tx})
+	}
+
+	sort.SliceStable(spooled, func(i, j int) bool {
+		return spooled[i].tx.Nonce() < spooled[j].tx.Nonce()
+	})
+	return spooled, nil
+}
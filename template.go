@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// templateFields are the transaction flags a template may set.
+var templateFields = map[string]bool{
+	"to": true, "from": true, "create": true, "nonce": true, "value": true,
+	"gas-price": true, "gas-limit": true, "chain-id": true, "data": true,
+	"rpc-url": true, "tx-type": true, "max-fee-per-gas": true,
+	"max-priority-fee-per-gas": true,
+}
+
+var placeholder = regexp.MustCompile(`\$\{([A-Za-z0-9_-]+)\}`)
+
+// readTemplate reads a transaction template: a JSON object mapping flag
+// names such as "to", "value" or "gas-limit" to strings, numbers or, for
+// "create", a boolean. Every ${name} in a string is replaced by the value
+// of --var name=VALUE, or else of the environment variable
+// ETHSIGN_VAR_NAME (upper-cased, with - turned into _). A placeholder
+// with neither is an error; there is no escape for a literal "${".
+func readTemplate(path string, vars []string) (map[string]string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(contents)))
+	decoder.UseNumber()
+	var template map[string]interface{}
+	if err := decoder.Decode(&template); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for _, v := range vars {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("--var %q is not NAME=VALUE", v)
+		}
+		values[parts[0]] = parts[1]
+	}
+
+	fields := make(map[string]string)
+	for name, raw := range template {
+		if !templateFields[name] {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		var field string
+		switch raw := raw.(type) {
+		case string:
+			field = raw
+		case json.Number:
+			field = raw.String()
+		case bool:
+			field = fmt.Sprint(raw)
+		default:
+			return nil, fmt.Errorf("field %q must be a string, number or boolean", name)
+		}
+
+		var missing []string
+		fields[name] = placeholder.ReplaceAllStringFunc(field, func(match string) string {
+			key := match[2 : len(match)-1]
+			if value, ok := values[key]; ok {
+				return value
+			}
+			env := "ETHSIGN_VAR_" + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+			if value, ok := os.LookupEnv(env); ok {
+				return value
+			}
+			missing = append(missing, key)
+			return match
+		})
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("no value for ${%s} in field %q (use --var %s=VALUE)", missing[0], name, missing[0])
+		}
+	}
+	return fields, nil
+}
+
+// applyTemplate sets each templated flag that was not given explicitly.
+func applyTemplate(c *cli.Context, fields map[string]string) error {
+	for name, value := range fields {
+		if c.IsSet(name) {
+			continue
+		}
+		if err := c.Set(name, value); err != nil {
+			return fmt.Errorf("invalid %s %q: %v", name, value, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+
+	"bytes"
+	"fmt"
+	"math/big"
+)
+
+// The pinned go-ethereum only knows legacy transactions, so typed
+// transactions (EIP-2718) are encoded and signed here.
+const (
+	accessListTxType = 1 // EIP-2930
+	dynamicFeeTxType = 2 // EIP-1559
+)
+
+// accessTuple is an address and the storage slots of it a transaction
+// declares it will touch (EIP-2930).
+type accessTuple struct {
+	Address     common.Address `json:"address"`
+	StorageKeys []common.Hash  `json:"storageKeys"`
+}
+
+type accessList []accessTuple
+
+// typedTx is an EIP-2930 or EIP-1559 transaction. GasPrice is used by
+// type 1, GasTipCap and GasFeeCap by type 2. V, R and S are nil until
+// the transaction is signed; V is the y parity, 0 or 1.
+type typedTx struct {
+	Type       byte
+	ChainID    *big.Int
+	Nonce      uint64
+	GasPrice   *big.Int
+	GasTipCap  *big.Int
+	GasFeeCap  *big.Int
+	Gas        uint64
+	To         *common.Address
+	Value      *big.Int
+	Data       []byte
+	AccessList accessList
+	V, R, S    *big.Int
+}
+
+// fields lists the transaction's RLP fields in order, without the
+// signature.
+func (tx *typedTx) fields() []interface{} {
+	// The empty string stands for no recipient in a contract creation.
+	var to interface{} = []byte{}
+	if tx.To != nil {
+		to = *tx.To
+	}
+	accesses := tx.AccessList
+	if accesses == nil {
+		accesses = accessList{}
+	}
+	if tx.Type == accessListTxType {
+		return []interface{}{tx.ChainID, tx.Nonce, tx.GasPrice, tx.Gas, to, tx.Value, tx.Data, accesses}
+	}
+	return []interface{}{tx.ChainID, tx.Nonce, tx.GasTipCap, tx.GasFeeCap, tx.Gas, to, tx.Value, tx.Data, accesses}
+}
+
+// sigHash is the hash that is signed: keccak256(type || rlp(fields)).
+func (tx *typedTx) sigHash() common.Hash {
+	payload, _ := rlp.EncodeToBytes(tx.fields())
+	return crypto.Keccak256Hash([]byte{tx.Type}, payload)
+}
+
+// withSignature returns a copy of the transaction with a 65-byte [R || S
+// || V] signature, as SignHashWithPassphrase makes, with V of 0 or 1.
+func (tx *typedTx) withSignature(sig []byte) (*typedTx, error) {
+	if len(sig) != 65 || sig[64] > 1 {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	signed := *tx
+	signed.R = new(big.Int).SetBytes(sig[:32])
+	signed.S = new(big.Int).SetBytes(sig[32:64])
+	signed.V = big.NewInt(int64(sig[64]))
+	return &signed, nil
+}
+
+// encode gives the signed transaction as sent to a node:
+// type || rlp(fields ++ [yParity, r, s]).
+func (tx *typedTx) encode() ([]byte, error) {
+	if tx.V == nil {
+		return nil, fmt.Errorf("transaction is not signed")
+	}
+	payload, err := rlp.EncodeToBytes(append(tx.fields(), tx.V, tx.R, tx.S))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{tx.Type}, payload...), nil
+}
+
+// hash is the hash of the signed transaction, which identifies it.
+func (tx *typedTx) hash() common.Hash {
+	encoded, _ := tx.encode()
+	return crypto.Keccak256Hash(encoded)
+}
+
+// sender recovers the address that signed the transaction.
+func (tx *typedTx) sender() (common.Address, error) {
+	if tx.V == nil {
+		return common.Address{}, fmt.Errorf("transaction is not signed")
+	}
+	sig := make([]byte, 65)
+	copy(sig[32-len(tx.R.Bytes()):32], tx.R.Bytes())
+	copy(sig[64-len(tx.S.Bytes()):64], tx.S.Bytes())
+	sig[64] = byte(tx.V.Uint64())
+	hash := tx.sigHash()
+	pub, err := crypto.Ecrecover(hash[:], sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return common.BytesToAddress(crypto.Keccak256(pub[1:])[12:]), nil
+}
+
+// maxGasPrice is the most the transaction can pay per unit of gas.
+func (tx *typedTx) maxGasPrice() *big.Int {
+	if tx.Type == accessListTxType {
+		return tx.GasPrice
+	}
+	return tx.GasFeeCap
+}
+
+// effectiveGasPrice is what the transaction pays per unit of gas in a
+// block with the given base fee: min(max fee, base fee + max priority
+// fee) for type 2, and the gas price for type 1.
+func (tx *typedTx) effectiveGasPrice(baseFee *big.Int) *big.Int {
+	if tx.Type == accessListTxType {
+		return new(big.Int).Set(tx.GasPrice)
+	}
+	price := new(big.Int).Add(baseFee, tx.GasTipCap)
+	if price.Cmp(tx.GasFeeCap) > 0 {
+		return new(big.Int).Set(tx.GasFeeCap)
+	}
+	return price
+}
+
+// accessListTxFields and dynamicFeeTxFields are the RLP layouts of
+// signed type 1 and type 2 transactions.
+type accessListTxFields struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasPrice   *big.Int
+	Gas        uint64
+	To         []byte
+	Value      *big.Int
+	Data       []byte
+	AccessList accessList
+	V, R, S    *big.Int
+}
+
+type dynamicFeeTxFields struct {
+	ChainID    *big.Int
+	Nonce      uint64
+	GasTipCap  *big.Int
+	GasFeeCap  *big.Int
+	Gas        uint64
+	To         []byte
+	Value      *big.Int
+	Data       []byte
+	AccessList accessList
+	V, R, S    *big.Int
+}
+
+// decodeTypedTx decodes a signed typed transaction.
+func decodeTypedTx(encoded []byte) (*typedTx, error) {
+	if len(encoded) == 0 || (encoded[0] != accessListTxType && encoded[0] != dynamicFeeTxType) {
+		return nil, fmt.Errorf("not a type 1 or type 2 transaction")
+	}
+
+	var to []byte
+	tx := &typedTx{Type: encoded[0]}
+	if tx.Type == accessListTxType {
+		var f accessListTxFields
+		if err := rlp.DecodeBytes(encoded[1:], &f); err != nil {
+			return nil, err
+		}
+		tx.ChainID, tx.Nonce, tx.GasPrice, tx.Gas = f.ChainID, f.Nonce, f.GasPrice, f.Gas
+		to, tx.Value, tx.Data, tx.AccessList = f.To, f.Value, f.Data, f.AccessList
+		tx.V, tx.R, tx.S = f.V, f.R, f.S
+	} else {
+		var f dynamicFeeTxFields
+		if err := rlp.DecodeBytes(encoded[1:], &f); err != nil {
+			return nil, err
+		}
+		tx.ChainID, tx.Nonce, tx.GasTipCap, tx.GasFeeCap, tx.Gas = f.ChainID, f.Nonce, f.GasTipCap, f.GasFeeCap, f.Gas
+		to, tx.Value, tx.Data, tx.AccessList = f.To, f.Value, f.Data, f.AccessList
+		tx.V, tx.R, tx.S = f.V, f.R, f.S
+	}
+
+	switch len(to) {
+	case 0:
+	case common.AddressLength:
+		address := common.BytesToAddress(to)
+		tx.To = &address
+	default:
+		return nil, fmt.Errorf("recipient is %d bytes, not 20", len(to))
+	}
+	if tx.V.Cmp(big.NewInt(1)) > 0 {
+		return nil, fmt.Errorf("y parity is %s, not 0 or 1", tx.V)
+	}
+	return tx, nil
+}
+
+// verifyTypedTx decodes a signed typed transaction and compares every
+// field and the recovered sender against what was meant to be signed, as
+// verifyEncodedTx does for legacy transactions.
+func verifyTypedTx(encoded []byte, want *typedTx, from common.Address) ([]string, error) {
+	got, err := decodeTypedTx(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var mismatches []string
+	mismatch := func(field string, want interface{}, got interface{}) {
+		mismatches = append(mismatches, fmt.Sprintf("%s: expected %v, got %v", field, want, got))
+	}
+	bigEqual := func(a, b *big.Int) bool {
+		return (a == nil) == (b == nil) && (a == nil || a.Cmp(b) == 0)
+	}
+
+	if got.Type != want.Type {
+		mismatch("type", want.Type, got.Type)
+	}
+	if !bigEqual(got.ChainID, want.ChainID) {
+		mismatch("chain ID", want.ChainID, got.ChainID)
+	}
+	if got.Nonce != want.Nonce {
+		mismatch("nonce", want.Nonce, got.Nonce)
+	}
+	if !bigEqual(got.GasPrice, want.GasPrice) {
+		mismatch("gas price", want.GasPrice, got.GasPrice)
+	}
+	if !bigEqual(got.GasTipCap, want.GasTipCap) {
+		mismatch("max priority fee per gas", want.GasTipCap, got.GasTipCap)
+	}
+	if !bigEqual(got.GasFeeCap, want.GasFeeCap) {
+		mismatch("max fee per gas", want.GasFeeCap, got.GasFeeCap)
+	}
+	if got.Gas != want.Gas {
+		mismatch("gas limit", want.Gas, got.Gas)
+	}
+	if (got.To == nil) != (want.To == nil) || (got.To != nil && *got.To != *want.To) {
+		mismatch("to", want.To, got.To)
+	}
+	if !bigEqual(got.Value, want.Value) {
+		mismatch("value", want.Value, got.Value)
+	}
+	if !bytes.Equal(got.Data, want.Data) {
+		mismatch("data", hexutil.Encode(want.Data), hexutil.Encode(got.Data))
+	}
+	if fmt.Sprint(got.AccessList) != fmt.Sprint(want.AccessList) && len(got.AccessList)+len(want.AccessList) > 0 {
+		mismatch("access list", want.AccessList, got.AccessList)
+	}
+
+	sender, err := got.sender()
+	if err != nil {
+		mismatches = append(mismatches, "from: "+err.Error())
+	} else if sender != from {
+		mismatch("from", from.Hex(), sender.Hex())
+	}
+	return mismatches, nil
+}
+
+// newSignedTypedTx is newSignedTx for typed transactions.
+func newSignedTypedTx(tx *typedTx, from common.Address) (*signedTx, error) {
+	raw, err := tx.encode()
+	if err != nil {
+		return nil, err
+	}
+	txType := hexutil.Uint64(tx.Type)
+	accesses := tx.AccessList
+	if accesses == nil {
+		accesses = accessList{}
+	}
+	return &signedTx{
+		Type:                 &txType,
+		Hash:                 tx.hash(),
+		From:                 from,
+		To:                   tx.To,
+		Nonce:                hexutil.Uint64(tx.Nonce),
+		GasPrice:             (*hexutil.Big)(tx.GasPrice),
+		MaxPriorityFeePerGas: (*hexutil.Big)(tx.GasTipCap),
+		MaxFeePerGas:         (*hexutil.Big)(tx.GasFeeCap),
+		GasLimit:             hexutil.Uint64(tx.Gas),
+		Value:                (*hexutil.Big)(tx.Value),
+		Data:                 tx.Data,
+		AccessList:           &accesses,
+		ChainID:              (*hexutil.Big)(tx.ChainID),
+		V:                    (*hexutil.Big)(tx.V),
+		R:                    (*hexutil.Big)(tx.R),
+		S:                    (*hexutil.Big)(tx.S),
+		Raw:                  raw,
+		Size:                 hexutil.Uint64(len(raw)),
+		IntrinsicGas:         hexutil.Uint64(intrinsicGas(tx.Data, tx.To == nil) + accessListGas(tx.AccessList)),
+	}, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"math/big"
+	"testing"
+)
+
+// TestTypedTx checks signing and encoding against transactions signed by
+// a go-ethereum release that supports EIP-2930 and EIP-1559.
+func TestTypedTx(t *testing.T) {
+	key, err := crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0x3535353535353535353535353535353535353535")
+	accesses := accessList{{
+		Address:     common.HexToAddress("0x00000000000000000000000000000000000000aa"),
+		StorageKeys: []common.Hash{common.HexToHash("0x01"), common.HexToHash("0x02")},
+	}}
+
+	tests := []struct {
+		tx      typedTx
+		sigHash string
+		hash    string
+		raw     string
+	}{
+		{
+			typedTx{Type: dynamicFeeTxType, ChainID: big.NewInt(1), Nonce: 9, GasTipCap: big.NewInt(2000000000), GasFeeCap: big.NewInt(30000000000), Gas: 21000, To: &to, Value: big.NewInt(1000000000000000000)},
+			"0xfae77debb64203fbaea6213fcde74f1b138c6854c3d7b44ba1c2ced52c2d8c4d",
+			"0x1786d8a4320784640a5a2466f9d2a05c034f885009d1b92abe339d74d1934007",
+			"0x02f873010984773594008506fc23ac00825208943535353535353535353535353535353535353535880de0b6b3a764000080c080a0de7bab948e0030460a300da80551186fdb77b89b1c3d4483d4553170e5b00fdfa041c507652276f75fb39bce1065455455925a212ff1dfa878b410be55cb3646ab",
+		},
+		{
+			typedTx{Type: dynamicFeeTxType, ChainID: big.NewInt(11155111), Nonce: 0, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(100), Gas: 100000, Value: big.NewInt(0), Data: []byte{0x60, 0x00}, AccessList: accesses},
+			"0x5f06632a8e58754b0b4200a7f713aeefb4b300961827efd487fca1b61c066dca",
+			"0xc172a51f6ffb10bb0988bdbfe1971cf980e23932c0824164e3a22bd06b038415",
+			"0x02f8b083aa36a7800164830186a08080826000f85bf8599400000000000000000000000000000000000000aaf842a00000000000000000000000000000000000000000000000000000000000000001a0000000000000000000000000000000000000000000000000000000000000000201a08a9f554fd18d578b260f374c9df56b405ec5a1da672d7a3978cdfed17127817ca0185e52adb8e38d7347d90a160c504fd0508158afee7ac9f27c6f0b1aa9feaad4",
+		},
+		{
+			typedTx{Type: accessListTxType, ChainID: big.NewInt(1), Nonce: 3, GasPrice: big.NewInt(20000000000), Gas: 50000, To: &to, Value: big.NewInt(5), Data: []byte{0xde, 0xad}, AccessList: accesses},
+			"0x30721e7d9bbc56e8312bd039aed62a03ec3eb50ac33cdd1fd47c909a68e3675c",
+			"0xec05e0e9d056347e2a8c6b972ae948079d9b735d8821060b48e26c0f0f0d7d39",
+			"0x01f8c401038504a817c80082c3509435353535353535353535353535353535353535350582deadf85bf8599400000000000000000000000000000000000000aaf842a00000000000000000000000000000000000000000000000000000000000000001a0000000000000000000000000000000000000000000000000000000000000000280a0cf05d28103fb01bbc21ce21c771f5ffc59808100a8c12c3aaf9510dc8a21feaba0372510ab53a2de0910c6928dc4af36a6f74fbd6fb0063ab12a982e6593e23230",
+		},
+	}
+	for i, test := range tests {
+		hash := test.tx.sigHash()
+		if hash.Hex() != test.sigHash {
+			t.Errorf("%d: got signing hash %s, want %s", i, hash.Hex(), test.sigHash)
+			continue
+		}
+		sig, err := crypto.Sign(hash[:], key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signed, err := test.tx.withSignature(sig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := signed.encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hexutil.Encode(raw) != test.raw {
+			t.Errorf("%d: got raw %x, want %s", i, raw, test.raw)
+		}
+		if signed.hash().Hex() != test.hash {
+			t.Errorf("%d: got hash %s, want %s", i, signed.hash().Hex(), test.hash)
+		}
+
+		mismatches, err := verifyTypedTx(raw, &test.tx, from)
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+		}
+		for _, m := range mismatches {
+			t.Errorf("%d: %s", i, m)
+		}
+	}
+}
+
+func TestVerifyTypedTxMismatch(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	to := common.HexToAddress("0x3535353535353535353535353535353535353535")
+	tx := typedTx{Type: dynamicFeeTxType, ChainID: big.NewInt(1), GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2), Gas: 21000, To: &to, Value: big.NewInt(1)}
+	hash := tx.sigHash()
+	sig, _ := crypto.Sign(hash[:], key)
+	signed, _ := tx.withSignature(sig)
+	raw, _ := signed.encode()
+
+	want := tx
+	want.Value = big.NewInt(2)
+	mismatches, err := verifyTypedTx(raw, &want, crypto.PubkeyToAddress(key.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) != 1 || mismatches[0] != "value: expected 2, got 1" {
+		t.Errorf("got mismatches %q", mismatches)
+	}
+
+	if _, err := decodeTypedTx(append([]byte{0x03}, raw[1:]...)); err == nil {
+		t.Errorf("decoded a type 3 transaction")
+	}
+}
+
+func TestEffectiveGasPrice(t *testing.T) {
+	dynamic := &typedTx{Type: dynamicFeeTxType, GasTipCap: big.NewInt(2), GasFeeCap: big.NewInt(30)}
+	accessList := &typedTx{Type: accessListTxType, GasPrice: big.NewInt(25)}
+	tests := []struct {
+		tx      *typedTx
+		baseFee int64
+		want    int64
+	}{
+		{dynamic, 10, 12},
+		{dynamic, 28, 30},
+		{dynamic, 29, 30},
+		{dynamic, 40, 30},
+		{dynamic, 0, 2},
+		{accessList, 10, 25},
+	}
+	for _, test := range tests {
+		if got := test.tx.effectiveGasPrice(big.NewInt(test.baseFee)); got.Int64() != test.want {
+			t.Errorf("type %d at base fee %d: got %s, want %d", test.tx.Type, test.baseFee, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// units are the denominations accepted in amounts, with their number of
+// decimals relative to wei. "gwei" must be tried before "wei".
+var units = []struct {
+	name     string
+	decimals int
+}{
+	{"ether", 18},
+	{"gwei", 9},
+	{"wei", 0},
+}
+
+// parseAmount parses an amount such as "21000", "1.5gwei" or "0.05ether"
+// into wei. Amounts without a unit are taken to be in wei.
+func parseAmount(s string) (*big.Int, error) {
+	number, decimals := s, 0
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.name) {
+			number, decimals = strings.TrimSpace(strings.TrimSuffix(s, unit.name)), unit.decimals
+			break
+		}
+	}
+
+	parts := strings.SplitN(number, ".", 2)
+	fraction := ""
+	if len(parts) == 2 {
+		fraction = parts[1]
+	}
+	if len(fraction) > decimals {
+		return nil, fmt.Errorf("too many decimals in %q", s)
+	}
+	digits := parts[0] + fraction + strings.Repeat("0", decimals-len(fraction))
+
+	amount, ok := new(big.Int).SetString(digits, 10)
+	if !ok || amount.Sign() < 0 {
+		return nil, fmt.Errorf("invalid amount %q", s)
+	}
+	return amount, nil
+}
+
+// formatEther formats an amount of wei as a decimal number of ether.
+func formatEther(wei *big.Int) string {
+	ether := new(big.Rat).SetFrac(wei, new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+	formatted := strings.TrimRight(ether.FloatString(18), "0")
+	return strings.TrimSuffix(formatted, ".")
+}
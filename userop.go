@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+
+	"math/big"
+)
+
+// entryPointAddress is the ERC-4337 v0.6 EntryPoint, which takes the
+// UserOperation layout below.
+const entryPointAddress = "0x5FF137D4b0FDCD49DcA30c7CF57E578a026d2789"
+
+// userOperation is an ERC-4337 v0.6 UserOperation in the JSON form that
+// bundlers accept in eth_sendUserOperation.
+type userOperation struct {
+	Sender               common.Address `json:"sender"`
+	Nonce                *hexutil.Big   `json:"nonce"`
+	InitCode             hexutil.Bytes  `json:"initCode"`
+	CallData             hexutil.Bytes  `json:"callData"`
+	CallGasLimit         *hexutil.Big   `json:"callGasLimit"`
+	VerificationGasLimit *hexutil.Big   `json:"verificationGasLimit"`
+	PreVerificationGas   *hexutil.Big   `json:"preVerificationGas"`
+	MaxFeePerGas         *hexutil.Big   `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big   `json:"maxPriorityFeePerGas"`
+	PaymasterAndData     hexutil.Bytes  `json:"paymasterAndData"`
+	Signature            hexutil.Bytes  `json:"signature"`
+}
+
+// hash computes the userOpHash as EntryPoint.getUserOpHash does: the
+// keccak256 of the packed operation, which hashes its dynamic fields,
+// encoded together with the EntryPoint address and chain ID.
+func (op *userOperation) hash(entryPoint common.Address, chainID *big.Int) []byte {
+	packed := crypto.Keccak256(encodeWords(
+		op.Sender,
+		op.Nonce.ToInt(),
+		crypto.Keccak256(op.InitCode),
+		crypto.Keccak256(op.CallData),
+		op.CallGasLimit.ToInt(),
+		op.VerificationGasLimit.ToInt(),
+		op.PreVerificationGas.ToInt(),
+		op.MaxFeePerGas.ToInt(),
+		op.MaxPriorityFeePerGas.ToInt(),
+		crypto.Keccak256(op.PaymasterAndData),
+	))
+	return crypto.Keccak256(encodeWords(packed, entryPoint, chainID))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/accounts"
+
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/urfave/cli.v1"
+)
+
+// findByUUID finds the keystore account whose key file has the given
+// id. Unlike an address, the id picks out a single key file.
+func findByUUID(wallets []accounts.Wallet, id string) (accounts.Wallet, *accounts.Account, error) {
+	for _, x := range wallets {
+		if x.URL().Scheme != "keystore" {
+			continue
+		}
+		for _, y := range x.Accounts() {
+			contents, err := ioutil.ReadFile(y.URL.Path)
+			if err != nil {
+				continue
+			}
+			var keyfile struct {
+				ID string `json:"id"`
+			}
+			if json.Unmarshal(contents, &keyfile) == nil && strings.EqualFold(keyfile.ID, id) {
+				return x, &y, nil
+			}
+		}
+	}
+	return nil, nil, fmt.Errorf("ethsign: no key file with id %s", id)
+}
+
+// applyFromUUID fills in --from with the address of the key file given
+// by --from-uuid, so that the rest of a command can use --from as usual.
+func applyFromUUID(c *cli.Context, defaultKeyStores []string) error {
+	if c.String("from-uuid") == "" {
+		return nil
+	}
+	_, acct, err := findByUUID(getWallets(c, defaultKeyStores, false), c.String("from-uuid"))
+	if err != nil {
+		return err
+	}
+	if c.String("from") != "" && !strings.EqualFold(c.String("from"), acct.Address.Hex()) {
+		return fmt.Errorf("ethsign: key file %s is for %s, not --from %s", c.String("from-uuid"), acct.Address.Hex(), c.String("from"))
+	}
+	c.Set("from", acct.Address.Hex())
+	return nil
+}
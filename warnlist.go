@@ -0,0 +1,56 @@
+package main
+
+import (
+	"github.com/ethereum/go-ethereum/common"
+
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// warnlistEntry is an address that should not normally receive
+// transactions, such as a burn address or a known scam contract.
+type warnlistEntry struct {
+	block bool
+	note  string
+}
+
+// readWarnlist reads a warnlist file. Each line holds an address,
+// optionally followed by "warn" or "block" (the default is warn) and a
+// free-form note. Blank lines and lines starting with # are ignored.
+func readWarnlist(path string) (map[common.Address]warnlistEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	warnlist := make(map[common.Address]warnlistEntry)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if !common.IsHexAddress(fields[0]) {
+			return nil, fmt.Errorf("line %d: invalid address %q", n, fields[0])
+		}
+
+		var entry warnlistEntry
+		if len(fields) > 1 {
+			switch fields[1] {
+			case "block":
+				entry.block = true
+			case "warn":
+			default:
+				return nil, fmt.Errorf("line %d: action must be warn or block", n)
+			}
+			entry.note = strings.Join(fields[2:], " ")
+		}
+		warnlist[common.HexToAddress(fields[0])] = entry
+	}
+	return warnlist, scanner.Err()
+}